@@ -0,0 +1,588 @@
+package pgrest
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// CBOR major types (RFC 8949)
+const (
+	cborUint   byte = 0
+	cborNegint byte = 1
+	cborBytes  byte = 2
+	cborText   byte = 3
+	cborArray  byte = 4
+	cborMap    byte = 5
+	cborTag    byte = 6
+	cborSimple byte = 7
+)
+
+// CBOR tags of date/time
+const (
+	cborTagDateTime uint64 = 0 // RFC 3339 text
+	cborTagEpoch    uint64 = 1 // seconds since epoch
+)
+
+// CBORCodec structure, CBOR codec (RFC 8949) using json tags, time is tag 1 and []byte is byte string
+type CBORCodec struct{}
+
+// MediaTypes implements Codec
+func (CBORCodec) MediaTypes() []string {
+	return []string{"application/cbor"}
+}
+
+// Encode implements Codec
+func (CBORCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, reflect.ValueOf(entity)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements Codec
+func (CBORCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	d := &cborDecoder{data: content}
+	item, err := d.decode()
+	if err == nil && d.pos != len(d.data) {
+		err = errors.New("unexpected data after CBOR item")
+	}
+	if err == nil {
+		err = assignCBOR(item, reflect.ValueOf(entity).Elem())
+	}
+	if err != nil {
+		return &Error{Message: "invalid CBOR content", Code: 400, Cause: err}
+	}
+	return nil
+}
+
+// writeCBORHead writes major type and argument in shortest form
+func writeCBORHead(buf *bytes.Buffer, major byte, arg uint64) {
+	m := major << 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(m | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.Write([]byte{m | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		buf.WriteByte(m | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(m | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(m | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
+
+func writeCBORInt(buf *bytes.Buffer, i int64) {
+	if i < 0 {
+		writeCBORHead(buf, cborNegint, uint64(-(i + 1)))
+	} else {
+		writeCBORHead(buf, cborUint, uint64(i))
+	}
+}
+
+func writeCBORText(buf *bytes.Buffer, s string) {
+	writeCBORHead(buf, cborText, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func writeCBORFloat(buf *bytes.Buffer, f float64) {
+	if float64(float32(f)) == f || math.IsNaN(f) {
+		buf.WriteByte(cborSimple<<5 | 26)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(float32(f)))
+	} else {
+		buf.WriteByte(cborSimple<<5 | 27)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	}
+}
+
+// encodeCBOR encodes value, structs are maps keyed by json names
+func encodeCBOR(buf *bytes.Buffer, value reflect.Value) error {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			buf.WriteByte(cborSimple<<5 | 22)
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		buf.WriteByte(cborSimple<<5 | 22)
+		return nil
+	}
+	if value.Type() == timeType {
+		t := value.Interface().(time.Time)
+		writeCBORHead(buf, cborTag, cborTagEpoch)
+		if t.Nanosecond() == 0 {
+			writeCBORInt(buf, t.Unix())
+		} else {
+			buf.WriteByte(cborSimple<<5 | 27)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(float64(t.UnixNano())/1e9))
+		}
+		return nil
+	}
+	if value.Type() == reflect.TypeOf(json.RawMessage{}) {
+		writeCBORText(buf, string(value.Bytes()))
+		return nil
+	}
+	if value.Type().Implements(textMarshalerType) {
+		text, err := value.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		writeCBORText(buf, string(text))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			buf.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buf.WriteByte(cborSimple<<5 | 20)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeCBORInt(buf, value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeCBORHead(buf, cborUint, value.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeCBORFloat(buf, value.Float())
+	case reflect.String:
+		writeCBORText(buf, value.String())
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			buf.WriteByte(cborSimple<<5 | 22)
+			return nil
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			writeCBORHead(buf, cborBytes, uint64(len(data)))
+			buf.Write(data)
+			return nil
+		}
+		writeCBORHead(buf, cborArray, uint64(value.Len()))
+		for i := 0; i < value.Len(); i++ {
+			if err := encodeCBOR(buf, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.IsNil() {
+			buf.WriteByte(cborSimple<<5 | 22)
+			return nil
+		}
+		writeCBORHead(buf, cborMap, uint64(value.Len()))
+		iter := value.MapRange()
+		for iter.Next() {
+			if err := encodeCBOR(buf, iter.Key()); err != nil {
+				return err
+			}
+			if err := encodeCBOR(buf, iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		keys := make([]string, 0, value.NumField())
+		values := make([]reflect.Value, 0, value.NumField())
+		collectCBORFields(value, &keys, &values)
+		writeCBORHead(buf, cborMap, uint64(len(keys)))
+		for i, key := range keys {
+			writeCBORText(buf, key)
+			if err := encodeCBOR(buf, values[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported CBOR type '%v'", value.Type())
+	}
+	return nil
+}
+
+// collectCBORFields collects struct fields by json names, embedded struct fields are inlined
+func collectCBORFields(value reflect.Value, keys *[]string, values *[]reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Anonymous && field.Tag.Get("json") == "" && reflect.Indirect(value.Field(i)).Kind() == reflect.Struct {
+			collectCBORFields(reflect.Indirect(value.Field(i)), keys, values)
+			continue
+		}
+		name, omitEmpty := structFieldName(field)
+		if name == "" || (omitEmpty && value.Field(i).IsZero()) {
+			continue
+		}
+		*keys = append(*keys, name)
+		*values = append(*values, value.Field(i))
+	}
+}
+
+// cborPair structure, key and value of decoded map
+type cborPair struct {
+	key   interface{}
+	value interface{}
+}
+
+// cborTagged structure, decoded tagged item
+type cborTagged struct {
+	number  uint64
+	content interface{}
+}
+
+// cborDecoder structure, decodes CBOR items into uint64, int64, float64, bool, nil,
+// []byte, string, []interface{}, []cborPair or cborTagged
+type cborDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+var errCBORBreak = errors.New("unexpected CBOR break")
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errors.New("unexpected end of CBOR data")
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// head reads major type, additional information and argument
+func (d *cborDecoder) head() (byte, byte, uint64, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		arg, err := d.read(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		var v uint64
+		for _, c := range arg {
+			v = v<<8 | uint64(c)
+		}
+		return major, info, v, nil
+	case info == 31:
+		return major, info, 0, nil
+	}
+	return 0, 0, 0, fmt.Errorf("invalid CBOR additional information %d", info)
+}
+
+func (d *cborDecoder) decode() (interface{}, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > 512 {
+		return nil, errors.New("CBOR nesting too deep")
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	indefinite := info == 31
+	switch major {
+	case cborUint:
+		return arg, nil
+	case cborNegint:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("CBOR negative integer overflows int64")
+		}
+		return -1 - int64(arg), nil
+	case cborBytes, cborText:
+		var data []byte
+		if indefinite {
+			for {
+				chunk, err := d.decode()
+				if err == errCBORBreak {
+					break
+				} else if err != nil {
+					return nil, err
+				}
+				switch c := chunk.(type) {
+				case []byte:
+					data = append(data, c...)
+				case string:
+					data = append(data, c...)
+				default:
+					return nil, errors.New("invalid CBOR string chunk")
+				}
+			}
+		} else if data, err = d.read(arg); err != nil {
+			return nil, err
+		}
+		if major == cborText {
+			return string(data), nil
+		}
+		return append([]byte{}, data...), nil
+	case cborArray:
+		items := make([]interface{}, 0)
+		for i := uint64(0); indefinite || i < arg; i++ {
+			item, err := d.decode()
+			if indefinite && err == errCBORBreak {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case cborMap:
+		pairs := make([]cborPair, 0)
+		for i := uint64(0); indefinite || i < arg; i++ {
+			key, err := d.decode()
+			if indefinite && err == errCBORBreak {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			value, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, cborPair{key, value})
+		}
+		return pairs, nil
+	case cborTag:
+		content, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		return cborTagged{arg, content}, nil
+	}
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfToFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	case 31:
+		return nil, errCBORBreak
+	}
+	return nil, fmt.Errorf("unsupported CBOR simple value %d", arg)
+}
+
+// halfToFloat converts IEEE 754 half precision float
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// cborTime converts tag 0 or tag 1 item, or untagged text or number, into time
+func cborTime(item interface{}) (time.Time, error) {
+	if tagged, ok := item.(cborTagged); ok {
+		if tagged.number != cborTagDateTime && tagged.number != cborTagEpoch {
+			return time.Time{}, fmt.Errorf("CBOR tag %d isn't a date/time", tagged.number)
+		}
+		item = tagged.content
+	}
+	switch v := item.(type) {
+	case string:
+		return time.Parse(time.RFC3339Nano, v)
+	case uint64:
+		return time.Unix(int64(v), 0), nil
+	case int64:
+		return time.Unix(v, 0), nil
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))), nil
+	}
+	return time.Time{}, fmt.Errorf("date/time expected, got '%v'", item)
+}
+
+// cborGeneric converts decoded item into generic value (map[string]interface{} for text keys)
+func cborGeneric(item interface{}) interface{} {
+	switch v := item.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = cborGeneric(v[i])
+		}
+		return v
+	case []cborPair:
+		m := make(map[string]interface{}, len(v))
+		for _, pair := range v {
+			m[fmt.Sprint(cborGeneric(pair.key))] = cborGeneric(pair.value)
+		}
+		return m
+	case cborTagged:
+		if t, err := cborTime(v); err == nil {
+			return t
+		}
+		return cborGeneric(v.content)
+	}
+	return item
+}
+
+// assignCBOR assigns decoded item to value, struct fields are matched by json name then case insensitive go name
+func assignCBOR(item interface{}, value reflect.Value) error {
+	if item == nil {
+		value.Set(reflect.Zero(value.Type()))
+		return nil
+	}
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return assignCBOR(item, value.Elem())
+	}
+	if value.Type() == timeType {
+		t, err := cborTime(item)
+		if err != nil {
+			return err
+		}
+		value.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if value.Kind() == reflect.Interface {
+		value.Set(reflect.ValueOf(cborGeneric(item)))
+		return nil
+	}
+	if tagged, ok := item.(cborTagged); ok {
+		item = tagged.content
+	}
+	if value.Type() == reflect.TypeOf(json.RawMessage{}) {
+		if s, ok := item.(string); ok {
+			value.SetBytes([]byte(s))
+			return nil
+		}
+	}
+	if s, ok := item.(string); ok && value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch v := item.(type) {
+	case bool:
+		if value.Kind() == reflect.Bool {
+			value.SetBool(v)
+			return nil
+		}
+	case uint64, int64, float64:
+		return assignCBORNumber(v, value)
+	case string:
+		if value.Kind() == reflect.String {
+			value.SetString(v)
+			return nil
+		}
+	case []byte:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			value.SetBytes(v)
+			return nil
+		} else if value.Kind() == reflect.Array && value.Type().Elem().Kind() == reflect.Uint8 && value.Len() == len(v) {
+			reflect.Copy(value, reflect.ValueOf(v))
+			return nil
+		}
+	case []interface{}:
+		if value.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(value.Type(), len(v), len(v))
+			for i, elem := range v {
+				if err := assignCBOR(elem, slice.Index(i)); err != nil {
+					return err
+				}
+			}
+			value.Set(slice)
+			return nil
+		}
+	case []cborPair:
+		return assignCBORMap(v, value)
+	}
+	return fmt.Errorf("can't assign CBOR '%v' to '%v'", item, value.Type())
+}
+
+func assignCBORNumber(item interface{}, value reflect.Value) error {
+	var f float64
+	switch v := item.(type) {
+	case uint64:
+		f = float64(v)
+		if value.Kind() >= reflect.Uint && value.Kind() <= reflect.Uintptr && !value.OverflowUint(v) {
+			value.SetUint(v)
+			return nil
+		} else if value.Kind() >= reflect.Int && value.Kind() <= reflect.Int64 && v <= math.MaxInt64 && !value.OverflowInt(int64(v)) {
+			value.SetInt(int64(v))
+			return nil
+		}
+	case int64:
+		f = float64(v)
+		if value.Kind() >= reflect.Int && value.Kind() <= reflect.Int64 && !value.OverflowInt(v) {
+			value.SetInt(v)
+			return nil
+		}
+	case float64:
+		f = v
+	}
+	if value.Kind() == reflect.Float32 || value.Kind() == reflect.Float64 {
+		value.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("can't assign CBOR number '%v' to '%v'", item, value.Type())
+}
+
+func assignCBORMap(pairs []cborPair, value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Map:
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+		for _, pair := range pairs {
+			k := reflect.New(value.Type().Key()).Elem()
+			if err := assignCBOR(pair.key, k); err != nil {
+				return err
+			}
+			v := reflect.New(value.Type().Elem()).Elem()
+			if err := assignCBOR(pair.value, v); err != nil {
+				return err
+			}
+			value.SetMapIndex(k, v)
+		}
+		return nil
+	case reflect.Struct:
+		for _, pair := range pairs {
+			key, ok := pair.key.(string)
+			if !ok {
+				continue
+			}
+			field := findStructField(value, key)
+			if !field.IsValid() {
+				continue
+			}
+			if err := assignCBOR(pair.value, field); err != nil {
+				return fmt.Errorf("invalid value for field '%v' (%v)", key, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("can't assign CBOR map to '%v'", value.Type())
+}
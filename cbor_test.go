@@ -0,0 +1,59 @@
+package pgrest_test
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+type CBORItem struct {
+	Name    string            `json:"name"`
+	Count   int               `json:"count,omitempty"`
+	Ratio   float64           `json:"ratio"`
+	Data    []byte            `json:"data"`
+	Date    time.Time         `json:"date"`
+	Tags    []string          `json:"tags"`
+	Attrs   map[string]string `json:"attrs"`
+	Ignored string            `json:"-"`
+}
+
+func TestCBORCodec(t *testing.T) {
+	codec := pgrest.CBORCodec{}
+
+	var err error
+	var data []byte
+
+	item := &CBORItem{Name: "a", Ratio: -1.5, Data: []byte{1, 2}, Date: time.Unix(1363896240, 0), Tags: []string{"x"}, Attrs: map[string]string{"k": "v"}, Ignored: "ignored"}
+	data, err = codec.Encode(nil, nil, item)
+	assert.Nil(t, err)
+	// {"name": "a", "ratio": -1.5, "data": h'0102', "date": 1(1363896240), "tags": ["x"], "attrs": {"k": "v"}}
+	assert.Equal(t, "a6646e616d65616165726174696ffabfc0000064646174614201026464617465c11a514b67b06474616773816178656174747273a1616b6176", hex.EncodeToString(data))
+
+	resItem := &CBORItem{}
+	err = codec.Decode(nil, nil, data, resItem)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", resItem.Name)
+	assert.Equal(t, -1.5, resItem.Ratio)
+	assert.Equal(t, []byte{1, 2}, resItem.Data)
+	assert.True(t, item.Date.Equal(resItem.Date))
+	assert.Equal(t, []string{"x"}, resItem.Tags)
+	assert.Equal(t, map[string]string{"k": "v"}, resItem.Attrs)
+	assert.Equal(t, "", resItem.Ignored)
+
+	// {"Name": "b", "count": 3, "date": 0("2013-03-21T20:04:00Z")} with indefinite length tags array
+	data, _ = hex.DecodeString("a4644e616d65616265636f756e74036464617465c074323031332d30332d32315432303a30343a30305a64746167739f61796178ff")
+	resItem = &CBORItem{}
+	err = codec.Decode(nil, nil, data, resItem)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", resItem.Name)
+	assert.Equal(t, 3, resItem.Count)
+	assert.True(t, time.Unix(1363896240, 0).Equal(resItem.Date))
+	assert.Equal(t, []string{"y", "x"}, resItem.Tags)
+
+	err = codec.Decode(nil, nil, []byte{0xa1, 0x64, 0x6e, 0x61}, resItem)
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+}
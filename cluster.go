@@ -0,0 +1,230 @@
+package pgrest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aptogeo/pgrest/transactional"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// ClusterMethod cluster method type
+type ClusterMethod string
+
+const (
+	// Grid cluster method, groups geometries snapped to a grid of cell size (ST_SnapToGrid)
+	Grid ClusterMethod = "grid"
+	// Kmeans cluster method, groups geometries into k clusters (ST_ClusterKMeans)
+	Kmeans ClusterMethod = "kmeans"
+)
+
+func (m ClusterMethod) String() string {
+	return string(m)
+}
+
+// AggregateFunc aggregate function type
+type AggregateFunc string
+
+const (
+	// Count aggregate function
+	Count AggregateFunc = "count"
+	// Sum aggregate function
+	Sum AggregateFunc = "sum"
+	// Avg aggregate function
+	Avg AggregateFunc = "avg"
+	// Min aggregate function
+	Min AggregateFunc = "min"
+	// Max aggregate function
+	Max AggregateFunc = "max"
+)
+
+func (f AggregateFunc) String() string {
+	return string(f)
+}
+
+func (f AggregateFunc) valid() bool {
+	switch f {
+	case Count, Sum, Avg, Min, Max:
+		return true
+	}
+	return false
+}
+
+// Aggregate structure, aggregate of attribute computed for each cluster
+type Aggregate struct {
+	Func AggregateFunc // aggregate function
+	Name string        // attribute name
+}
+
+func (a *Aggregate) String() string {
+	return fmt.Sprintf("%v(%v)", a.Func, a.Name)
+}
+
+// key gets aggregate key in cluster aggregates ('sum_nb_pages')
+func (a *Aggregate) key() string {
+	return fmt.Sprintf("%v_%v", a.Func, a.Name)
+}
+
+// Cluster structure, clustering of geometries
+type Cluster struct {
+	Method     ClusterMethod // cluster method
+	CellSize   float64       // grid cell size in units of geometry field SRID
+	K          int           // number of kmeans clusters
+	Aggregates []*Aggregate  // optional aggregates
+}
+
+func (c *Cluster) String() string {
+	var str string
+	if c.Method == Grid {
+		str = fmt.Sprintf("%v(%v)", c.Method, c.CellSize)
+	} else {
+		str = fmt.Sprintf("%v(%v)", c.Method, c.K)
+	}
+	if len(c.Aggregates) > 0 {
+		str += fmt.Sprintf(" aggregates=%v", c.Aggregates)
+	}
+	return str
+}
+
+// ClusterItem structure, cluster centroid with count and aggregates
+type ClusterItem struct {
+	Geometry   string                 `json:"geometry"`
+	Count      int                    `json:"count"`
+	Aggregates map[string]interface{} `json:"aggregates,omitempty"`
+}
+
+var aggregateRegexp = regexp.MustCompile(`^(\w+)\(\s*([^()\s]+)\s*\)$`)
+
+// decodeCluster decodes cluster method, cell size, k and aggregates ('sum(nb_pages),max(nb_pages)') parameters
+func decodeCluster(method string, cellSizeStr string, kStr string, aggregatesStr string) (*Cluster, error) {
+	cluster := &Cluster{Method: ClusterMethod(strings.ToLower(method))}
+	switch cluster.Method {
+	case Grid:
+		cellSize, err := strconv.ParseFloat(cellSizeStr, 64)
+		if err != nil || cellSize <= 0 {
+			return nil, NewErrorParam("cellSize", errors.New("must be a positive number"))
+		}
+		cluster.CellSize = cellSize
+	case Kmeans:
+		k, err := strconv.Atoi(kStr)
+		if err != nil || k < 1 {
+			return nil, NewErrorParam("k", errors.New("must be a positive integer"))
+		}
+		cluster.K = k
+	default:
+		return nil, NewErrorParam("cluster", fmt.Errorf("unknown cluster method '%v'", method))
+	}
+	for _, s := range splitParam(aggregatesStr) {
+		st := strings.TrimSpace(s)
+		if st == "" {
+			continue
+		}
+		res := aggregateRegexp.FindStringSubmatch(st)
+		if res == nil {
+			return nil, NewErrorParam("aggregates", fmt.Errorf("invalid aggregate '%v'", st))
+		}
+		aggregate := &Aggregate{Func: AggregateFunc(strings.ToLower(res[1])), Name: res[2]}
+		if !aggregate.Func.valid() {
+			return nil, NewErrorParam("aggregates", fmt.Errorf("unknown aggregate function '%v'", res[1]))
+		}
+		cluster.Aggregates = append(cluster.Aggregates, aggregate)
+	}
+	return cluster, nil
+}
+
+// coerceAggregates checks aggregate attributes and sets their sql names
+func coerceAggregates(table *orm.Table, aggregates []*Aggregate) error {
+	for _, aggregate := range aggregates {
+		field := findField(table, aggregate.Name)
+		if field == nil {
+			return NewErrorParam("aggregates", fmt.Errorf("unknown attribute '%v'", aggregate.Name))
+		}
+		aggregate.Name = field.SQLName
+	}
+	return nil
+}
+
+// ClusterExecFunc gets cluster execution function
+func (e *Executor) ClusterExecFunc() transactional.ExecFunc {
+	return func(ctx context.Context, tx *pg.Tx) error {
+		cluster := e.restQuery.Cluster
+		if e.resource == nil || e.resource.GeometryField() == "" {
+			return NewErrorBadRequest(fmt.Sprintf("resource '%v' without geometry field", e.restQuery.Resource))
+		}
+		if err := checkExtension(ctx, tx, "postgis"); err != nil {
+			return err
+		}
+		if err := e.transformSpatialValues(ctx, tx); err != nil {
+			return err
+		}
+		geometryField := types.Ident(e.resource.GeometryField())
+		q := tx.ModelContext(ctx, e.entity).ColumnExpr("?TableColumns")
+		q, err := addQueryFilter(q, e.restQuery.Filter, And)
+		if err != nil {
+			return err
+		}
+		count, err := q.Count()
+		if err != nil {
+			return NewErrorFromCause(e.restQuery, err)
+		}
+		e.clusters = make([]ClusterItem, 0)
+		if count == 0 {
+			return nil
+		}
+		if cluster.Method == Grid {
+			q = q.ColumnExpr("ST_SnapToGrid(?, ?) AS cluster_id", geometryField, cluster.CellSize)
+		} else {
+			k := cluster.K
+			if k > count {
+				k = count
+			}
+			q = q.ColumnExpr("ST_ClusterKMeans(?, ?) OVER () AS cluster_id", geometryField, k)
+		}
+		geometryExpr := e.geometryExpr()
+		if geometryExpr == "" {
+			geometryExpr = "?"
+		}
+		w := q.WrapWith("clusters").Table("clusters").
+			ColumnExpr(geometryExpr+" AS geometry", pg.SafeQuery("ST_Centroid(ST_Collect(?))", geometryField)).
+			ColumnExpr("count(*) AS count")
+		if len(cluster.Aggregates) > 0 {
+			exprs := make([]string, len(cluster.Aggregates))
+			params := make([]interface{}, 0, 3*len(cluster.Aggregates))
+			for i, aggregate := range cluster.Aggregates {
+				exprs[i] = "?, ?(?)"
+				params = append(params, aggregate.key(), types.Safe(aggregate.Func), types.Ident(aggregate.Name))
+			}
+			w = w.ColumnExpr("json_build_object("+strings.Join(exprs, ", ")+") AS aggregates", params...)
+		}
+		w = w.Group("cluster_id").OrderExpr("count DESC").OrderExpr("cluster_id")
+		// Clusters are paged like rows, small grid cells may give one cluster per row
+		w = addQueryOffset(addQueryLimit(w, e.restQuery.Limit), e.restQuery.Offset)
+		if e.count, err = w.SelectAndCount(&e.clusters); err != nil {
+			return NewErrorFromCause(e.restQuery, err)
+		}
+		return nil
+	}
+}
+
+// newClusterFeatureCollection constructs FeatureCollection of cluster centroids, geometry must contain GeoJSON
+func newClusterFeatureCollection(page *Page, clusters []ClusterItem) *FeatureCollection {
+	fc := &FeatureCollection{Type: "FeatureCollection", Features: make([]*Feature, 0), Offset: page.Offset, Limit: page.Limit, Count: page.Count}
+	for _, cluster := range clusters {
+		f := &Feature{Type: "Feature", Geometry: json.RawMessage("null"), Properties: map[string]interface{}{"count": cluster.Count}}
+		if strings.HasPrefix(cluster.Geometry, "{") {
+			f.Geometry = json.RawMessage(cluster.Geometry)
+		}
+		for k, v := range cluster.Aggregates {
+			f.Properties[k] = v
+		}
+		fc.Features = append(fc.Features, f)
+	}
+	return fc
+}
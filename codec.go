@@ -0,0 +1,287 @@
+package pgrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var jsonRegexp = regexp.MustCompile("[+-/]json($|[+-;])")
+
+// ErrUnsupported is returned by codecs that only encode or only decode
+var ErrUnsupported = errors.New("unsupported by codec")
+
+// Codec interface, encodes and decodes media types
+type Codec interface {
+	// MediaTypes gets handled media types ('application/json'), first one is response content type
+	MediaTypes() []string
+	// Encode encodes entity, page or other execution result
+	Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error)
+	// Decode decodes content into entity
+	Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error
+}
+
+// StreamEncoder interface, implemented by codecs writing encoded entity directly to response
+type StreamEncoder interface {
+	// EncodeTo encodes entity, page or other execution result into writer
+	EncodeTo(writer io.Writer, restQuery *RestQuery, resource *Resource, entity interface{}) error
+}
+
+// EncodingChecker interface, implemented by codecs which can't encode responses of every resource
+type EncodingChecker interface {
+	// CanEncode checks that responses of resource can be encoded, resource is nil for responses without resource
+	CanEncode(resource *Resource) bool
+}
+
+// AddCodec adds codec, it takes precedence over previously added codecs for same media types
+func (c *Config) AddCodec(codec Codec) {
+	c.codecs = append([]Codec{codec}, c.codecs...)
+}
+
+// Codecs gets codecs by precedence
+func (c *Config) Codecs() []Codec {
+	return c.codecs
+}
+
+// acceptRange structure, media range of Accept header
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// specificity gets media range specificity: 0 for '*/*', 1 for 'type/*', 2 for 'type/subtype'
+func (r *acceptRange) specificity() int {
+	if r.mediaType == "*/*" {
+		return 0
+	} else if strings.HasSuffix(r.mediaType, "/*") {
+		return 1
+	}
+	return 2
+}
+
+// matches checks that media range matches media type
+func (r *acceptRange) matches(mediaType string) bool {
+	switch r.specificity() {
+	case 0:
+		return true
+	case 1:
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*"))
+	}
+	return r.mediaType == mediaType
+}
+
+// parseAccept parses Accept header into media ranges sorted by quality then specificity
+func parseAccept(accept string) []*acceptRange {
+	ranges := make([]*acceptRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := &acceptRange{mediaType: mediaTypeOf(params[0]), q: 1}
+		if r.mediaType == "" {
+			continue
+		}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				q, err := strconv.ParseFloat(kv[1], 64)
+				if err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+				r.q = q
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+// mediaTypeOf gets lower case media type without parameters
+func mediaTypeOf(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// codecFor gets codec handling media type, exactly or by structured syntax suffix ('application/vnd.api+json')
+func (c *Config) codecFor(mediaType string) Codec {
+	for _, codec := range c.codecs {
+		for _, codecMediaType := range codec.MediaTypes() {
+			if mediaTypeOf(codecMediaType) == mediaType {
+				return codec
+			}
+		}
+	}
+	if i := strings.LastIndex(mediaType, "+"); i > 0 {
+		suffixMediaType := mediaType[:strings.Index(mediaType, "/")+1] + mediaType[i+1:]
+		for _, codec := range c.codecs {
+			for _, codecMediaType := range codec.MediaTypes() {
+				if mediaTypeOf(codecMediaType) == suffixMediaType {
+					return codec
+				}
+			}
+		}
+	}
+	if mediaType != "application/json" && jsonRegexp.MatchString(mediaType) {
+		// JSON variants ('text/json', 'application/x-json', 'text/foo+json', ...) are handled as JSON
+		return c.codecFor("application/json")
+	}
+	return nil
+}
+
+// canEncode checks that codec can encode responses of resource
+func canEncode(codec Codec, resource *Resource) bool {
+	if checker, ok := codec.(EncodingChecker); ok {
+		return checker.CanEncode(resource)
+	}
+	return true
+}
+
+// negotiateCodec gets codec and media type of Accept header encoding responses of resource, default
+// accept is preferred for wildcards
+func (c *Config) negotiateCodec(accept string, resource *Resource) (Codec, string, error) {
+	ranges := parseAccept(accept)
+	// acceptable checks that no more specific media range excludes media type
+	acceptable := func(mediaType string, r *acceptRange) bool {
+		for _, other := range ranges {
+			if other.q == 0 && other.specificity() > r.specificity() && other.matches(mediaType) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, r := range ranges {
+		if r.q == 0 {
+			continue
+		}
+		if r.specificity() == 2 {
+			if codec := c.codecFor(r.mediaType); codec != nil && canEncode(codec, resource) {
+				return codec, r.mediaType, nil
+			}
+			continue
+		}
+		candidates := []string{mediaTypeOf(c.DefaultAccept())}
+		for _, codec := range c.codecs {
+			for _, codecMediaType := range codec.MediaTypes() {
+				candidates = append(candidates, mediaTypeOf(codecMediaType))
+			}
+		}
+		for _, mediaType := range candidates {
+			if codec := c.codecFor(mediaType); codec != nil && canEncode(codec, resource) && r.matches(mediaType) && acceptable(mediaType, r) {
+				return codec, mediaType, nil
+			}
+		}
+	}
+	return nil, "", NewErrorNotAcceptable(fmt.Sprintf("no codec for accept '%v'", accept))
+}
+
+// decodingCodec gets codec of content type
+func (c *Config) decodingCodec(contentType string) (Codec, error) {
+	if codec := c.codecFor(mediaTypeOf(contentType)); codec != nil {
+		return codec, nil
+	}
+	return nil, NewErrorUnsupportedMediaType(fmt.Sprintf("unknown content type '%v'", contentType))
+}
+
+// JSONCodec structure, JSON codec
+type JSONCodec struct{}
+
+// MediaTypes implements Codec
+func (JSONCodec) MediaTypes() []string {
+	return []string{"application/json; charset=utf-8"}
+}
+
+// Encode implements Codec
+func (JSONCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	return json.Marshal(entity)
+}
+
+// Decode implements Codec
+func (JSONCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	return json.Unmarshal(content, entity)
+}
+
+// MsgpackCodec structure, MessagePack codec using json tags
+type MsgpackCodec struct{}
+
+// MediaTypes implements Codec
+func (MsgpackCodec) MediaTypes() []string {
+	return []string{"application/x-msgpack", "application/msgpack", "application/x-messagepack", "application/messagepack"}
+}
+
+// Encode implements Codec
+func (MsgpackCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(entity); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements Codec
+func (MsgpackCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(content))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(entity)
+}
+
+// FormCodec structure, form decoder ('Title=a title&NbPages=310'), keys are go or sql field names
+type FormCodec struct{}
+
+// MediaTypes implements Codec
+func (FormCodec) MediaTypes() []string {
+	return []string{"application/x-www-form-urlencoded"}
+}
+
+// CanEncode implements EncodingChecker, form codec only decodes
+func (FormCodec) CanEncode(resource *Resource) bool {
+	return false
+}
+
+// Encode implements Codec
+func (FormCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// Decode implements Codec
+func (FormCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	table := orm.GetTable(resource.ResourceType())
+	keyValues := strings.Split(string(content), "&")
+	elem := reflect.ValueOf(entity).Elem()
+	for _, keyValue := range keyValues {
+		parts := strings.Split(keyValue, "=")
+		if parts != nil && len(parts) == 2 {
+			found := false
+			for _, field := range table.Fields {
+				if field.GoName == parts[0] {
+					field.ScanValue(elem, NewBytesReader([]byte(parts[1])), len(parts[1]))
+					found = true
+				}
+			}
+			if !found {
+				for _, field := range table.Fields {
+					if field.SQLName == parts[0] {
+						field.ScanValue(elem, NewBytesReader([]byte(parts[1])), len(parts[1]))
+						found = true
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
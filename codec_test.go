@@ -0,0 +1,104 @@
+package pgrest_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+type textCodec struct{}
+
+func (textCodec) MediaTypes() []string {
+	return []string{"text/plain; charset=utf-8"}
+}
+
+func (textCodec) Encode(restQuery *pgrest.RestQuery, resource *pgrest.Resource, entity interface{}) ([]byte, error) {
+	return []byte(restQuery.Resource), nil
+}
+
+func (textCodec) Decode(restQuery *pgrest.RestQuery, resource *pgrest.Resource, content []byte, entity interface{}) error {
+	entity.(*Book).Title = string(content)
+	return nil
+}
+
+var codecNegotiationTests = []struct {
+	method      string
+	accept      string
+	contentType string
+	expected    string
+	code        int
+}{
+	{"GET", "", "", "application/json", 0},
+	{"GET", "application/msgpack;q=0.5, application/json", "", "application/json", 0},
+	{"GET", "application/json;q=0.5, application/x-msgpack", "", "application/x-msgpack", 0},
+	{"GET", "text/html, */*;q=0.1", "", "application/json", 0},
+	{"GET", "application/*", "", "application/json", 0},
+	{"GET", "*/*, application/json;q=0", "", "text/csv", 0},
+	{"GET", "application/geo+json", "", "", 406},
+	{"GET", "application/x-www-form-urlencoded", "", "", 406},
+	{"DELETE", "application/x-www-form-urlencoded", "", "", 406},
+	{"GET", "application/vnd.api+json", "", "application/vnd.api+json", 0},
+	{"GET", "text/json", "", "text/json", 0},
+	{"GET", "application/x-json", "", "application/x-json", 0},
+	{"GET", "text/vnd.custom+json", "", "text/vnd.custom+json", 0},
+	{"GET", "text/*", "", "text/csv", 0},
+	{"GET", "text/html", "", "", 406},
+	{"GET", "application/json;q=0", "", "", 406},
+	{"POST", "", "application/json; charset=utf-8", "application/json", 0},
+	{"POST", "", "application/x-www-form-urlencoded", "application/json", 0},
+	{"POST", "", "text/json; charset=utf-8", "application/json", 0},
+	{"POST", "", "text/plain", "", 415},
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	config.AddResource(pgrest.NewResource("Book", (*Book)(nil), pgrest.All))
+
+	for _, ct := range codecNegotiationTests {
+		req := httptest.NewRequest(ct.method, "/rest/Book", bytes.NewBufferString(""))
+		req.Header.Set("Accept", ct.accept)
+		req.Header.Set("Content-Type", ct.contentType)
+		restQuery, err := pgrest.DecodeRequest(req, config)
+		if ct.code != 0 {
+			assert.NotNil(t, err, ct.accept)
+			assert.Equal(t, ct.code, err.(*pgrest.Error).StatusCode(), ct.accept)
+		} else {
+			assert.Nil(t, err, ct.accept)
+			assert.Equal(t, ct.expected, restQuery.Accept, ct.accept)
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	resource := pgrest.NewResource("Book", (*Book)(nil), pgrest.All)
+	config.AddResource(resource)
+	config.AddCodec(textCodec{})
+	server := pgrest.NewServer(config)
+
+	var err error
+	var data []byte
+	var contentType string
+	var book *Book
+
+	data, contentType, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Accept: "text/plain"}, &Book{})
+	assert.Nil(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", contentType)
+	assert.Equal(t, "Book", string(data))
+
+	book = &Book{}
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", ContentType: "text/plain", Content: []byte("a text title")}, resource, book)
+	assert.Nil(t, err)
+	assert.Equal(t, "a text title", book.Title)
+
+	_, _, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Accept: "application/x-www-form-urlencoded"}, &Book{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 406, err.(*pgrest.Error).StatusCode())
+
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", ContentType: "application/gpx+xml", Content: []byte("<gpx/>")}, resource, &Book{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 415, err.(*pgrest.Error).StatusCode())
+}
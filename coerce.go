@@ -0,0 +1,251 @@
+package pgrest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// Enum is implemented by field types restricted to a set of values
+type Enum interface {
+	EnumValues() []string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// maxExactFloatInt bounds integers exactly represented by float64 (2^53 may be rounded 2^53+1)
+const maxExactFloatInt = 1 << 53
+
+var uuidRegexp = regexp.MustCompile("^(?i)[0-9a-f]{8}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{12}$")
+var decimalRegexp = regexp.MustCompile(`^[-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// coerceFilter converts filter values according to go-pg field types of filtered attributes,
+// defaultSRID is used for spatial values without SRID
+func coerceFilter(table *orm.Table, filter *Filter, defaultSRID int) error {
+	if filter == nil {
+		return nil
+	}
+	if filter.Op == And || filter.Op == Or {
+		for _, subfilter := range filter.Filters {
+			if err := coerceFilter(table, subfilter, defaultSRID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if isSpatialOp(filter.Op) {
+		return coerceSpatialFilter(filter, defaultSRID)
+	}
+	switch filter.Op {
+	case Eq, Neq, Gt, Gte, Lt, Lte, In, Nin:
+	default:
+		// Pattern and null operations keep their value
+		return nil
+	}
+	field := findField(table, filter.Attr)
+	if field == nil || filter.Value == nil {
+		return nil
+	}
+	var err error
+	if filter.Op == In || filter.Op == Nin {
+		filter.Value, err = coerceValues(field, filter.Value)
+	} else {
+		filter.Value, err = coerceValue(field, filter.Value)
+	}
+	if err != nil {
+		return &Error{Message: fmt.Sprintf("invalid value for attribute '%v'", filter.Attr), Code: 400, Cause: err}
+	}
+	return nil
+}
+
+// findField finds field by sql name or go name
+func findField(table *orm.Table, name string) *orm.Field {
+	if table == nil {
+		return nil
+	}
+	if field, ok := table.FieldsMap[name]; ok {
+		return field
+	}
+	for _, field := range table.Fields {
+		if field.GoName == name {
+			return field
+		}
+	}
+	return nil
+}
+
+func coerceValues(field *orm.Field, value interface{}) ([]interface{}, error) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("array expected, got '%v'", value)
+	}
+	values := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		v, err := coerceValue(field, rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func coerceValue(field *orm.Field, value interface{}) (interface{}, error) {
+	if n, ok := value.(json.Number); ok {
+		value = n.String()
+	}
+	typ := field.Type
+	for typ.Kind() == reflect.Ptr {
+		// Nullable fields are coerced as their element type (go-pg only indirects field type once)
+		typ = typ.Elem()
+	}
+	if typ.Implements(enumType) || reflect.PtrTo(typ).Implements(enumType) {
+		return coerceEnum(typ, value)
+	}
+	if typ == timeType {
+		return coerceTime(value)
+	}
+	sqlType := strings.ToLower(field.SQLType)
+	if sqlType == "uuid" || (typ.Kind() == reflect.Array && typ.Len() == 16 && typ.Elem().Kind() == reflect.Uint8) {
+		str := fmt.Sprint(value)
+		if !uuidRegexp.MatchString(str) {
+			return nil, fmt.Errorf("uuid expected, got '%v'", value)
+		}
+		return str, nil
+	}
+	if strings.HasPrefix(sqlType, "numeric") || strings.HasPrefix(sqlType, "decimal") {
+		return coerceDecimal(value)
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return coerceBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return coerceInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := coerceInt(value)
+		if err == nil && i < 0 {
+			return nil, fmt.Errorf("unsigned integer expected, got '%v'", value)
+		}
+		return i, err
+	case reflect.Float32, reflect.Float64:
+		return coerceFloat(value)
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		return nil, fmt.Errorf("string expected, got '%v'", value)
+	}
+	return value, nil
+}
+
+func coerceTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("RFC 3339 time expected, got '%v'", value)
+}
+
+func coerceBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("boolean expected, got '%v'", value)
+}
+
+func coerceInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case float64:
+		// Larger JSON numbers may have lost precision, they must be given as strings
+		if math.Abs(v) < maxExactFloatInt && v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i, nil
+		}
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(rv.Uint()), nil
+		}
+	}
+	return 0, fmt.Errorf("integer expected, got '%v'", value)
+}
+
+func coerceFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, nil
+		}
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(rv.Int()), nil
+		case reflect.Float32:
+			return rv.Float(), nil
+		}
+	}
+	return 0, fmt.Errorf("number expected, got '%v'", value)
+}
+
+func coerceDecimal(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case string:
+		if decimalRegexp.MatchString(v) {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("decimal expected, got '%v'", value)
+}
+
+func coerceEnum(typ reflect.Type, value interface{}) (string, error) {
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("string expected, got '%v'", value)
+	}
+	enum, ok := reflect.New(typ).Elem().Interface().(Enum)
+	if !ok {
+		enum = reflect.New(typ).Interface().(Enum)
+	}
+	for _, v := range enum.EnumValues() {
+		if v == str {
+			return str, nil
+		}
+	}
+	return "", fmt.Errorf("one of %v expected, got '%v'", enum.EnumValues(), value)
+}
@@ -6,16 +6,34 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 
+	"github.com/aptogeo/pgrest/transactional"
 	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 )
 
 // Resource structure
 type Resource struct {
-	name         string
-	resourceType reflect.Type
-	action       Action
+	name             string
+	resourceType     reflect.Type
+	action           Action
+	maxBodySize      int64
+	defaultLimit     int
+	maxLimit         int
+	strictLimit      bool
+	defaultSorts     []*Sort
+	maxRelationDepth int
+	geometryField    string
+	minZoom          int
+	maxZoom          int
+	tileTolerance    float64
+	temporalField    string
+	nameField        string
+	descriptionField string
+	srid             int
+	srids            map[string]int
+	sridMutex        sync.Mutex
 }
 
 func (r *Resource) String() string {
@@ -39,6 +57,165 @@ func (r *Resource) Action() Action {
 	return r.action
 }
 
+// SetMaxBodySize sets maximum request body size in bytes (0 uses configuration maximum)
+func (r *Resource) SetMaxBodySize(maxBodySize int64) {
+	r.maxBodySize = maxBodySize
+}
+
+// MaxBodySize gets maximum request body size in bytes
+func (r *Resource) MaxBodySize() int64 {
+	return r.maxBodySize
+}
+
+// SetDefaultLimit sets limit used when none is given (0 uses configuration default limit)
+func (r *Resource) SetDefaultLimit(defaultLimit int) {
+	r.defaultLimit = defaultLimit
+}
+
+// DefaultLimit gets default limit
+func (r *Resource) DefaultLimit() int {
+	return r.defaultLimit
+}
+
+// SetMaxLimit sets maximum limit (0 uses configuration maximum limit)
+func (r *Resource) SetMaxLimit(maxLimit int) {
+	r.maxLimit = maxLimit
+}
+
+// MaxLimit gets maximum limit
+func (r *Resource) MaxLimit() int {
+	return r.maxLimit
+}
+
+// SetStrictLimit sets strict limit: a limit over maximum limit is rejected instead of being clamped
+func (r *Resource) SetStrictLimit(strictLimit bool) {
+	r.strictLimit = strictLimit
+}
+
+// StrictLimit gets strict limit
+func (r *Resource) StrictLimit() bool {
+	return r.strictLimit
+}
+
+// SetDefaultSorts sets sorts used when none is given (primary keys are used if no default sorts)
+func (r *Resource) SetDefaultSorts(defaultSorts ...*Sort) {
+	r.defaultSorts = defaultSorts
+}
+
+// DefaultSorts gets default sorts
+func (r *Resource) DefaultSorts() []*Sort {
+	return r.defaultSorts
+}
+
+// SetMaxRelationDepth sets maximum relation embedding depth (0 uses configuration maximum depth)
+func (r *Resource) SetMaxRelationDepth(maxRelationDepth int) {
+	r.maxRelationDepth = maxRelationDepth
+}
+
+// MaxRelationDepth gets maximum relation embedding depth
+func (r *Resource) MaxRelationDepth() int {
+	return r.maxRelationDepth
+}
+
+// SetGeometryField sets geometry field name (go or sql name)
+func (r *Resource) SetGeometryField(geometryField string) {
+	r.geometryField = geometryField
+}
+
+// GeometryField gets geometry field sql name, first geometry or geography field if not set
+func (r *Resource) GeometryField() string {
+	table := orm.GetTable(r.resourceType)
+	if r.geometryField != "" {
+		if field := findField(table, r.geometryField); field != nil {
+			return field.SQLName
+		}
+		return r.geometryField
+	}
+	for _, field := range table.Fields {
+		if isGeometryField(field) {
+			return field.SQLName
+		}
+	}
+	return ""
+}
+
+// SetMinZoom sets minimum zoom level of vector tiles
+func (r *Resource) SetMinZoom(minZoom int) {
+	r.minZoom = minZoom
+}
+
+// MinZoom gets minimum zoom level of vector tiles
+func (r *Resource) MinZoom() int {
+	return r.minZoom
+}
+
+// SetMaxZoom sets maximum zoom level of vector tiles (0 for no maximum)
+func (r *Resource) SetMaxZoom(maxZoom int) {
+	r.maxZoom = maxZoom
+}
+
+// MaxZoom gets maximum zoom level of vector tiles
+func (r *Resource) MaxZoom() int {
+	return r.maxZoom
+}
+
+// SetTileTolerance sets simplification tolerance of vector tile geometries in tile extent units (0 for no simplification)
+func (r *Resource) SetTileTolerance(tileTolerance float64) {
+	r.tileTolerance = tileTolerance
+}
+
+// TileTolerance gets simplification tolerance of vector tile geometries
+func (r *Resource) TileTolerance() float64 {
+	return r.tileTolerance
+}
+
+// SetTemporalField sets temporal field name (go or sql name) filtered by OGC API datetime parameter
+func (r *Resource) SetTemporalField(temporalField string) {
+	r.temporalField = temporalField
+}
+
+// TemporalField gets temporal field sql name, empty if not set
+func (r *Resource) TemporalField() string {
+	if field := findField(orm.GetTable(r.resourceType), r.temporalField); field != nil {
+		return field.SQLName
+	}
+	return r.temporalField
+}
+
+// SetNameField sets field name (go or sql name) used as feature name in KML and GPX exports
+func (r *Resource) SetNameField(nameField string) {
+	r.nameField = nameField
+}
+
+// NameField gets feature name field
+func (r *Resource) NameField() string {
+	return r.nameField
+}
+
+// SetDescriptionField sets field name (go or sql name) used as feature description in KML and GPX exports
+func (r *Resource) SetDescriptionField(descriptionField string) {
+	r.descriptionField = descriptionField
+}
+
+// DescriptionField gets feature description field
+func (r *Resource) DescriptionField() string {
+	return r.descriptionField
+}
+
+// SetSRID sets SRID of geometry field (0 looks it up from geometry_columns)
+func (r *Resource) SetSRID(srid int) {
+	r.sridMutex.Lock()
+	defer r.sridMutex.Unlock()
+	r.srid = srid
+}
+
+// SRID gets SRID of geometry field set with SetSRID (0 if looked up from geometry_columns)
+func (r *Resource) SRID() int {
+	r.sridMutex.Lock()
+	defer r.sridMutex.Unlock()
+	return r.srid
+}
+
 // NewResource constructs Resource
 func NewResource(name string, entity interface{}, action Action) *Resource {
 	orm.RegisterTable(entity)
@@ -59,6 +236,17 @@ type Config struct {
 	resources          map[string]*Resource
 	defaultContentType string
 	defaultAccept      string
+	threshold          float64
+	maxBodySize        int64
+	defaultLimit       int
+	maxLimit           int
+	maxRelationDepth   int
+	csvMaxLimit        int
+	streamMaxLimit     int
+	copyMaxBodySize    int64
+	readOnlyGet        bool
+	retryPolicy        *transactional.RetryPolicy
+	codecs             []Codec
 	infoLogger         *log.Logger
 	errorLogger        *log.Logger
 }
@@ -119,6 +307,130 @@ func (c *Config) DefaultAccept() string {
 	return c.defaultAccept
 }
 
+// SetThreshold sets default similarity threshold (0 keeps pg_trgm default)
+func (c *Config) SetThreshold(threshold float64) {
+	c.threshold = threshold
+}
+
+// Threshold gets default similarity threshold
+func (c *Config) Threshold() float64 {
+	return c.threshold
+}
+
+// SetMaxBodySize sets default maximum request body size in bytes
+func (c *Config) SetMaxBodySize(maxBodySize int64) {
+	c.maxBodySize = maxBodySize
+}
+
+// MaxBodySize gets default maximum request body size in bytes
+func (c *Config) MaxBodySize() int64 {
+	return c.maxBodySize
+}
+
+// SetDefaultLimit sets default limit
+func (c *Config) SetDefaultLimit(defaultLimit int) {
+	c.defaultLimit = defaultLimit
+}
+
+// DefaultLimit gets default limit
+func (c *Config) DefaultLimit() int {
+	return c.defaultLimit
+}
+
+// SetMaxLimit sets default maximum limit, also used when no limit is given (1000 by default, 0 for no maximum)
+func (c *Config) SetMaxLimit(maxLimit int) {
+	c.maxLimit = maxLimit
+}
+
+// MaxLimit gets default maximum limit
+func (c *Config) MaxLimit() int {
+	return c.maxLimit
+}
+
+// SetMaxRelationDepth sets default maximum relation embedding depth (0 for no maximum)
+func (c *Config) SetMaxRelationDepth(maxRelationDepth int) {
+	c.maxRelationDepth = maxRelationDepth
+}
+
+// MaxRelationDepth gets default maximum relation embedding depth
+func (c *Config) MaxRelationDepth() int {
+	return c.maxRelationDepth
+}
+
+// SetCSVMaxLimit sets maximum limit of CSV and XLSX responses, also used when no limit is given (0 for no maximum)
+func (c *Config) SetCSVMaxLimit(csvMaxLimit int) {
+	c.csvMaxLimit = csvMaxLimit
+}
+
+// CSVMaxLimit gets maximum limit of CSV and XLSX responses
+func (c *Config) CSVMaxLimit() int {
+	return c.csvMaxLimit
+}
+
+// SetReadOnlyGet sets whether get queries are executed in read-only transactions
+func (c *Config) SetReadOnlyGet(readOnlyGet bool) {
+	c.readOnlyGet = readOnlyGet
+}
+
+// ReadOnlyGet gets whether get queries are executed in read-only transactions
+func (c *Config) ReadOnlyGet() bool {
+	return c.readOnlyGet
+}
+
+// SetRetryPolicy sets retry policy of write queries failing with serialization failure or deadlock (nil for no retry)
+func (c *Config) SetRetryPolicy(retryPolicy *transactional.RetryPolicy) {
+	c.retryPolicy = retryPolicy
+}
+
+// RetryPolicy gets retry policy of write queries
+func (c *Config) RetryPolicy() *transactional.RetryPolicy {
+	return c.retryPolicy
+}
+
+// SetStreamMaxLimit sets maximum limit of streamed NDJSON responses, also used when no limit is given (0 for no maximum)
+func (c *Config) SetStreamMaxLimit(streamMaxLimit int) {
+	c.streamMaxLimit = streamMaxLimit
+}
+
+// StreamMaxLimit gets maximum limit of streamed NDJSON responses
+func (c *Config) StreamMaxLimit() int {
+	return c.streamMaxLimit
+}
+
+// SetCopyMaxBodySize sets maximum size in bytes of COPY import request body, streamed to database (0 for no maximum)
+func (c *Config) SetCopyMaxBodySize(copyMaxBodySize int64) {
+	c.copyMaxBodySize = copyMaxBodySize
+}
+
+// CopyMaxBodySize gets maximum size in bytes of COPY import request body
+func (c *Config) CopyMaxBodySize() int64 {
+	return c.copyMaxBodySize
+}
+
+// resourceDefaultLimit gets default limit of resource
+func (c *Config) resourceDefaultLimit(resource *Resource) int {
+	if resource != nil && resource.DefaultLimit() > 0 {
+		return resource.DefaultLimit()
+	}
+	return c.defaultLimit
+}
+
+// resourceMaxLimit gets maximum limit of resource
+func (c *Config) resourceMaxLimit(resource *Resource) int {
+	if resource != nil && resource.MaxLimit() > 0 {
+		return resource.MaxLimit()
+	}
+	return c.maxLimit
+}
+
+// resourceMaxRelationDepth gets maximum relation embedding depth of resource
+func (c *Config) resourceMaxRelationDepth(resource *Resource) int {
+	if resource != nil && resource.MaxRelationDepth() > 0 {
+		return resource.MaxRelationDepth()
+	}
+	return c.maxRelationDepth
+}
+
 // DB gets db
 func (c *Config) DB() *pg.DB {
 	return c.db
@@ -152,6 +464,13 @@ func NewConfig(prefix string, db *pg.DB) *Config {
 	c.resources = make(map[string]*Resource)
 	c.defaultContentType = "application/json"
 	c.defaultAccept = "application/json"
+	c.maxBodySize = 10 << 20
+	c.copyMaxBodySize = 1 << 30
+	c.defaultLimit = 10
+	c.maxLimit = 1000
+	c.csvMaxLimit = 10000
+	c.readOnlyGet = true
+	c.codecs = []Codec{JSONCodec{}, GeoJSONCodec{}, KMLCodec{}, GPXCodec{}, CSVCodec{}, XLSXCodec{}, NDJSONCodec{}, XMLCodec{}, MsgpackCodec{}, CBORCodec{}, FormCodec{}}
 	c.infoLogger = log.New(os.Stdout, " INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
 	c.errorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
 	return c
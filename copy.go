@@ -0,0 +1,239 @@
+package pgrest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/aptogeo/pgrest/transactional"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// CopyKey is key of COPY endpoints ('{prefix}{resource}/_copy')
+const CopyKey = "_copy"
+
+// CopyFormat COPY format type
+type CopyFormat string
+
+const (
+	// CopyCSV CSV format with header row
+	CopyCSV CopyFormat = "csv"
+	// CopyBinary PostgreSQL binary format
+	CopyBinary CopyFormat = "binary"
+)
+
+func (f CopyFormat) String() string {
+	return string(f)
+}
+
+func (f CopyFormat) valid() bool {
+	return f == CopyCSV || f == CopyBinary
+}
+
+// ContentType gets content type of COPY format
+func (f CopyFormat) ContentType() string {
+	if f == CopyBinary {
+		return "application/octet-stream"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// options gets COPY options
+func (f CopyFormat) options() types.Safe {
+	if f == CopyBinary {
+		return types.Safe("FORMAT binary")
+	}
+	return types.Safe("FORMAT csv, HEADER true")
+}
+
+// CopyResult structure, result of COPY import
+type CopyResult struct {
+	Count int `json:"count"`
+}
+
+// CopyTo exports rows matching filter of rest query to writer with COPY TO STDOUT
+func (e *Engine) CopyTo(restQuery *RestQuery, writer io.Writer) error {
+	executor, err := e.copyExecutor(restQuery)
+	if err != nil {
+		return err
+	}
+	if err = e.coerceSliceQuery(restQuery, executor.resource); err != nil {
+		return err
+	}
+	return e.transaction(restQuery, func(ctx context.Context) error {
+		return executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.CopyToExecFunc(writer))
+	})
+}
+
+// CopyFrom imports content of rest query with COPY FROM STDIN, all rows or none are imported.
+// Without content, request body is streamed up to COPY maximum body size and import isn't retried
+func (e *Engine) CopyFrom(restQuery *RestQuery) (*CopyResult, error) {
+	executor, err := e.copyExecutor(restQuery)
+	if err != nil {
+		return nil, err
+	}
+	if restQuery.Content == nil && restQuery.Request != nil && restQuery.Request.Body != nil {
+		body := &copyBodyReader{reader: restQuery.Request.Body, maxSize: e.Config().CopyMaxBodySize()}
+		err = e.transactionWithRetry(restQuery, nil, func(ctx context.Context) error {
+			return executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.CopyFromExecFunc(body))
+		})
+	} else {
+		err = e.transaction(restQuery, func(ctx context.Context) error {
+			// Content is read again by retried attempts
+			reader := bytes.NewReader(restQuery.Content)
+			executor.count = 0
+			return executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.CopyFromExecFunc(reader))
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CopyResult{Count: executor.count}, nil
+}
+
+// copyBodyReader structure, reads request body up to maximum size. Read errors and exceeded size
+// end content early and are reported after COPY so that connection leaves COPY state cleanly
+type copyBodyReader struct {
+	reader   io.Reader
+	maxSize  int64
+	size     int64
+	err      error
+	exceeded bool
+}
+
+// Read implements io.Reader
+func (r *copyBodyReader) Read(p []byte) (int, error) {
+	if r.err != nil || r.exceeded {
+		return 0, io.EOF
+	}
+	n, err := r.reader.Read(p)
+	r.size += int64(n)
+	if r.maxSize > 0 && r.size > r.maxSize {
+		r.exceeded = true
+		return 0, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		r.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// check gets error of ended content
+func (r *copyBodyReader) check() error {
+	if r.exceeded {
+		return NewErrorRequestTooLarge(fmt.Sprintf("COPY request body exceeds %v bytes", r.maxSize))
+	}
+	if r.err != nil {
+		return NewErrorBadRequest(fmt.Sprintf("unable to read request body (%v)", r.err))
+	}
+	return nil
+}
+
+// copyExecutor checks COPY rest query and constructs its executor
+func (e *Engine) copyExecutor(restQuery *RestQuery) (*Executor, error) {
+	if restQuery.Debug {
+		e.Config().InfoLogger().Printf("Copy request %v\n", restQuery)
+	}
+	resource, err := e.getResource(restQuery)
+	if err != nil {
+		return nil, &Error{Cause: err}
+	}
+	if !restQuery.Copy.valid() {
+		return nil, NewErrorParam("format", fmt.Errorf("unknown COPY format '%v'", restQuery.Copy))
+	}
+	if _, err = copyColumns(orm.GetTable(resource.ResourceType()), restQuery.Fields); err != nil {
+		return nil, err
+	}
+	executor := NewExecutor(restQuery, reflect.New(resource.ResourceType()).Interface())
+	executor.SetResource(resource)
+	return executor, nil
+}
+
+// CopyToExecFunc gets COPY TO STDOUT execution function
+func (e *Executor) CopyToExecFunc(writer io.Writer) transactional.ExecFunc {
+	return func(ctx context.Context, tx *pg.Tx) error {
+		columns, err := copyColumns(orm.GetTable(e.resource.ResourceType()), e.restQuery.Fields)
+		if err != nil {
+			return err
+		}
+		if usesPostgis(e.restQuery.Filter, e.restQuery.Sorts) {
+			if err = checkExtension(ctx, tx, "postgis"); err != nil {
+				return err
+			}
+			if err = e.transformSpatialValues(ctx, tx); err != nil {
+				return err
+			}
+		}
+		q := tx.ModelContext(ctx, e.entity)
+		for _, column := range columns {
+			q = q.Column(column)
+		}
+		q = addQuerySorts(q, e.restQuery.Sorts)
+		if q, err = addQueryFilter(q, e.restQuery.Filter, And); err != nil {
+			return err
+		}
+		res, err := tx.CopyTo(writer, "COPY (?) TO STDOUT WITH (?)", q, e.restQuery.Copy.options())
+		if err != nil {
+			return NewErrorFromCause(e.restQuery, err)
+		}
+		e.count = res.RowsAffected()
+		return nil
+	}
+}
+
+// CopyFromExecFunc gets COPY FROM STDIN execution function
+func (e *Executor) CopyFromExecFunc(reader io.Reader) transactional.ExecFunc {
+	return func(ctx context.Context, tx *pg.Tx) error {
+		table := orm.GetTable(e.resource.ResourceType())
+		columns, err := copyColumns(table, e.restQuery.Fields)
+		if err != nil {
+			return err
+		}
+		idents := make([]types.Ident, len(columns))
+		for i, column := range columns {
+			idents[i] = types.Ident(column)
+		}
+		res, err := tx.CopyFrom(reader, "COPY ? (?) FROM STDIN WITH (?)", table.SQLName, pg.In(idents), e.restQuery.Copy.options())
+		if body, ok := reader.(*copyBodyReader); ok {
+			// Truncated content is rejected whatever COPY result
+			if berr := body.check(); berr != nil {
+				return berr
+			}
+		}
+		if _, ok := err.(pg.Error); ok {
+			// Rejected content
+			return &Error{Message: "COPY import failed", Code: 400, Cause: err}
+		} else if err != nil {
+			return NewErrorFromCause(e.restQuery, err)
+		}
+		e.count = res.RowsAffected()
+		return nil
+	}
+}
+
+// copyColumns gets sql names of selected fields, all table columns if none selected
+func copyColumns(table *orm.Table, fields []*Field) ([]string, error) {
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.Name == "*" {
+			columns = columns[:0]
+			break
+		}
+		f := findField(table, field.Name)
+		if f == nil {
+			return nil, NewErrorParam("fields", fmt.Errorf("unknown attribute '%v'", field.Name))
+		}
+		columns = append(columns, f.SQLName)
+	}
+	if len(columns) == 0 {
+		for _, f := range table.Fields {
+			columns = append(columns, f.SQLName)
+		}
+	}
+	return columns, nil
+}
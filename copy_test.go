@@ -0,0 +1,68 @@
+package pgrest_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopy(t *testing.T) {
+	db, config := initTests(t)
+	defer db.Close()
+	server := pgrest.NewServer(config)
+
+	var err error
+	var result *pgrest.CopyResult
+	var buf bytes.Buffer
+
+	result, err = server.CopyFrom(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", Copy: pgrest.CopyCSV, Fields: []*pgrest.Field{{Name: "id"}, {Name: "Title"}, {Name: "nb_pages"}}, Content: []byte("id,title,nb_pages\n1,Le Procès,320\n2,\"Le Château, roman\",410\n")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Count)
+
+	// Duplicated key rolls whole import back
+	_, err = server.CopyFrom(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", Copy: pgrest.CopyCSV, Fields: []*pgrest.Field{{Name: "id"}, {Name: "title"}}, Content: []byte("id,title\n3,L'Amérique\n1,Le Procès\n")})
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+
+	_, err = server.CopyFrom(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", Copy: pgrest.CopyCSV, Fields: []*pgrest.Field{{Name: "unknown"}}})
+	assert.NotNil(t, err)
+	assert.Equal(t, "fields", err.(*pgrest.Error).Param)
+
+	err = server.CopyTo(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Copy: pgrest.CopyCSV, Fields: []*pgrest.Field{{Name: "id"}, {Name: "title"}}, Sorts: []*pgrest.Sort{{Name: "id", Asc: true}}, Filter: &pgrest.Filter{Op: pgrest.Gt, Attr: "nb_pages", Value: "100"}}, &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "id,title\n1,Le Procès\n2,\"Le Château, roman\"\n", buf.String())
+
+	req := httptest.NewRequest("GET", "/rest/Book/_copy?format=binary", nil)
+	res := httptest.NewRecorder()
+	server.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/octet-stream", res.Header().Get("Content-Type"))
+	binary := res.Body.Bytes()
+	assert.True(t, bytes.HasPrefix(binary, []byte("PGCOPY\n\xff\r\n\x00")))
+
+	_, err = db.Exec("DELETE FROM books")
+	assert.Nil(t, err)
+	req = httptest.NewRequest("POST", "/rest/Book/_copy?format=binary", bytes.NewReader(binary))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	res = httptest.NewRecorder()
+	server.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "{\"count\":2}", res.Body.String())
+
+	// Streamed body beyond COPY maximum size rolls whole import back
+	_, err = db.Exec("DELETE FROM books")
+	assert.Nil(t, err)
+	config.SetCopyMaxBodySize(int64(len(binary) - 1))
+	req = httptest.NewRequest("POST", "/rest/Book/_copy?format=binary", bytes.NewReader(binary))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	res = httptest.NewRecorder()
+	server.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	count, err := db.Model((*Book)(nil)).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,238 @@
+package pgrest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+var csvRegexp = regexp.MustCompile("[+-/]csv($|[+-;])")
+
+// csvFormulaRegexp matches string values run as formulas by spreadsheets, after quotes escaping them
+var csvFormulaRegexp = regexp.MustCompile("^'*[=+\\-@\t\r]")
+
+// csvFlushRows is number of rows written between flushes of streamed CSV
+const csvFlushRows = 100
+
+// CSVCodec structure, CSV codec with header row, bulk decodes rows into slice. String values
+// starting with '=', '+', '-', '@', tab or carriage return are prefixed with a quote so that
+// spreadsheets don't run them as formulas, quote is removed on import
+type CSVCodec struct{}
+
+// MediaTypes implements Codec
+func (CSVCodec) MediaTypes() []string {
+	return []string{"text/csv; charset=utf-8"}
+}
+
+// Encode implements Codec
+func (c CSVCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.EncodeTo(&buf, restQuery, resource, entity); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeTo implements StreamEncoder, header row is built from selected fields
+func (CSVCodec) EncodeTo(writer io.Writer, restQuery *RestQuery, resource *Resource, entity interface{}) error {
+	if resource == nil {
+		return NewErrorBadRequest(fmt.Sprintf("resource '%v' not defined in engine configuration", restQuery.Resource))
+	}
+	if page, ok := entity.(*Page); ok {
+		entity = page.Slice
+	}
+	value := reflect.Indirect(reflect.ValueOf(entity))
+	if value.Kind() != reflect.Slice {
+		slice := reflect.MakeSlice(reflect.SliceOf(value.Type()), 0, 1)
+		value = reflect.Append(slice, value)
+	}
+	if value.Type().Elem() != resource.ResourceType() {
+		return NewErrorNotAcceptable(fmt.Sprintf("'%v' can't be encoded as CSV", value.Type()))
+	}
+	fields := csvFields(orm.GetTable(resource.ResourceType()), restQuery.Fields)
+	w := csv.NewWriter(writer)
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		record[i] = field.SQLName
+	}
+	if err := w.Write(record); err != nil {
+		return err
+	}
+	for i := 0; i < value.Len(); i++ {
+		elem := value.Index(i)
+		for j, field := range fields {
+			record[j] = csvValue(field.Value(elem))
+			if field.Type.Kind() == reflect.String && csvFormulaRegexp.MatchString(record[j]) {
+				record[j] = "'" + record[j]
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+		if (i+1)%csvFlushRows == 0 {
+			w.Flush()
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Decode implements Codec, content is decoded into slice pointer or into entity from first row,
+// header names are go or sql field names and errors are reported by start line of rows. Start
+// lines of bulk rows are kept in rest query for insert errors
+func (CSVCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	table := orm.GetTable(resource.ResourceType())
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	records := make([][]string, 0)
+	lines := make([]int, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return NewErrorBadRequest(fmt.Sprintf("invalid CSV content (%v)", err))
+		}
+		// Quoted values may span lines and blank lines are skipped
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+	if len(records) == 0 {
+		return NewErrorBadRequest("CSV header row is missing")
+	}
+	fields := make([]*orm.Field, len(records[0]))
+	for i, name := range records[0] {
+		if fields[i] = csvField(table, strings.TrimSpace(name)); fields[i] == nil {
+			return NewErrorBadRequest(fmt.Sprintf("line %d: unknown attribute '%v'", lines[0], name))
+		}
+	}
+	value := reflect.ValueOf(entity).Elem()
+	bulk := value.Kind() == reflect.Slice
+	if bulk && restQuery != nil {
+		restQuery.lines = lines[1:]
+	}
+	lineErrors := make([]string, 0)
+	for i, record := range records[1:] {
+		line := lines[i+1]
+		if len(record) != len(fields) {
+			lineErrors = append(lineErrors, fmt.Sprintf("line %d: %d values expected, got %d", line, len(fields), len(record)))
+			continue
+		}
+		elem := value
+		if bulk {
+			elem = reflect.New(value.Type().Elem()).Elem()
+		}
+		for j, field := range fields {
+			str := record[j]
+			if field.Type.Kind() == reflect.String && strings.HasPrefix(str, "'") && csvFormulaRegexp.MatchString(str[1:]) {
+				// Formula escaping quote
+				str = str[1:]
+			}
+			if str != "" && field.Type.Kind() == reflect.Bool {
+				// go-pg only scans 't' as true
+				b, err := coerceBool(str)
+				if err != nil {
+					lineErrors = append(lineErrors, fmt.Sprintf("line %d: invalid value for attribute '%v' (%v)", line, field.SQLName, err))
+					continue
+				}
+				str = strconv.FormatBool(b)[:1]
+			}
+			n := len(str)
+			if n == 0 {
+				// Empty value is NULL
+				n = -1
+			}
+			if err := field.ScanValue(elem, NewBytesReader([]byte(str)), n); err != nil {
+				lineErrors = append(lineErrors, fmt.Sprintf("line %d: invalid value for attribute '%v' (%v)", line, field.SQLName, err))
+			}
+		}
+		if !bulk {
+			break
+		}
+		value.Set(reflect.Append(value, elem))
+	}
+	if len(lineErrors) > 0 {
+		return NewErrorBadRequest(strings.Join(lineErrors, "; "))
+	}
+	return nil
+}
+
+// csvFields gets table fields of selected fields, all fields if none selected
+func csvFields(table *orm.Table, fields []*Field) []*orm.Field {
+	csvFields := make([]*orm.Field, 0)
+	for _, field := range fields {
+		if field.Name == "*" {
+			return table.Fields
+		}
+		if f := findField(table, field.Name); f != nil {
+			csvFields = append(csvFields, f)
+		}
+	}
+	if len(csvFields) == 0 {
+		return table.Fields
+	}
+	return csvFields
+}
+
+// csvField finds field by go name or sql name, like form decoder
+func csvField(table *orm.Table, name string) *orm.Field {
+	for _, field := range table.Fields {
+		if field.GoName == name {
+			return field
+		}
+	}
+	return findField(table, name)
+}
+
+// csvValue formats field value as CSV value, NULL is empty value and objects are JSON
+func csvValue(value reflect.Value) string {
+	value = reflect.Indirect(value)
+	if !value.IsValid() {
+		return ""
+	}
+	switch v := value.Interface().(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		if len(v) == 0 {
+			return ""
+		}
+		// PostgreSQL bytea hex format, decoded back on import
+		return "\\x" + hex.EncodeToString(v)
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64)
+	}
+	if stringer, ok := value.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	data, err := json.Marshal(value.Interface())
+	if err != nil {
+		return fmt.Sprint(value.Interface())
+	}
+	return string(data)
+}
@@ -0,0 +1,96 @@
+package pgrest_test
+
+import (
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSV(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	resource := pgrest.NewResource("Author", (*Author)(nil), pgrest.All)
+	config.AddResource(resource)
+	server := pgrest.NewServer(config)
+
+	var err error
+	var data []byte
+	var contentType string
+
+	authors := []Author{
+		{ID: 1, Firstname: "Antoine", Lastname: "de Saint Exupéry", Picture: []byte{187, 163}},
+		{ID: 2, Firstname: "Francis, Scott", Lastname: "Fitzgerald"},
+	}
+	page := &pgrest.Page{Slice: &authors, Offset: 0, Limit: 10, Count: 2}
+
+	data, contentType, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Author", Accept: "text/csv"}, page)
+	assert.Nil(t, err)
+	assert.Equal(t, "text/csv; charset=utf-8", contentType)
+	assert.Equal(t, "id,firstname,lastname,picture\n1,Antoine,de Saint Exupéry,\\xbba3\n2,\"Francis, Scott\",Fitzgerald,\n", string(data))
+
+	data, _, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Author", Accept: "text/csv", Fields: []*pgrest.Field{{Name: "Lastname"}, {Name: "id"}}}, &authors[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "lastname,id\nde Saint Exupéry,1\n", string(data))
+
+	var resAuthors []Author
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "text/csv", Content: []byte("Firstname,lastname,picture\nFranz,Kafka,\\xbba3\nFrancis,\n")}, resource, &resAuthors)
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+	assert.Contains(t, err.Error(), "line 3: 3 values expected, got 2")
+
+	resAuthors = nil
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "text/csv", Content: []byte("Firstname,lastname,picture\nFranz,Kafka,\\xbba3\n\"Francis, Scott\",,\n")}, resource, &resAuthors)
+	assert.Nil(t, err)
+	assert.Equal(t, []Author{{Firstname: "Franz", Lastname: "Kafka", Picture: []byte{187, 163}}, {Firstname: "Francis, Scott"}}, resAuthors)
+
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "text/csv", Content: []byte("Firstname,Unknown\nFranz,Kafka\n")}, resource, &resAuthors)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "line 1: unknown attribute 'Unknown'")
+
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "text/csv", Content: []byte("id,Firstname\n1,Franz\nx,Franz\n")}, resource, &resAuthors)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "line 3: invalid value for attribute 'id'")
+
+	// String values run as formulas by spreadsheets are escaped with a quote, removed on import
+	formulas := []Author{{ID: -1, Firstname: "=HYPERLINK(\"http://evil\")", Lastname: "'+1"}, {ID: 2, Firstname: "@SUM(A1)", Lastname: "'quoted"}}
+	data, _, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Author", Accept: "text/csv", Fields: []*pgrest.Field{{Name: "id"}, {Name: "Firstname"}, {Name: "Lastname"}}}, &pgrest.Page{Slice: &formulas, Count: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, "id,firstname,lastname\n-1,\"'=HYPERLINK(\"\"http://evil\"\")\",''+1\n2,'@SUM(A1),'quoted\n", string(data))
+	resAuthors = nil
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "text/csv", Content: data}, resource, &resAuthors)
+	assert.Nil(t, err)
+	assert.Equal(t, formulas, resAuthors)
+
+	// Lines of quoted values and blank lines are counted
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "text/csv", Content: []byte("id,Firstname\n1,\"Franz\nKafka\"\n\nx,Franz\n")}, resource, &resAuthors)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "line 5: invalid value for attribute 'id'")
+}
+
+func TestCSVImport(t *testing.T) {
+	db, config := initTests(t)
+	defer db.Close()
+	engine := pgrest.NewEngine(config)
+
+	var err error
+	var res interface{}
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", ContentType: "text/csv", Content: []byte("Title,NbPages,AuthorID\nLe Procès,320,2\nLe Château,410,2\n")})
+	assert.Nil(t, err)
+	resBooks := *res.(*[]Book)
+	assert.Equal(t, 2, len(resBooks))
+	assert.NotEqual(t, 0, resBooks[0].ID)
+	assert.Equal(t, "Le Château", resBooks[1].Title)
+
+	_, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", ContentType: "text/csv", Content: []byte("id,Title\n100,A\n100,B\n")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "line 3")
+
+	_, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", ContentType: "text/csv", Content: []byte("id,Title\n100,\"A\nB\"\n\n100,C\n")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "line 5")
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Accept: "text/csv", Fields: []*pgrest.Field{{Name: "title"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, res.(*pgrest.Page).Count)
+}
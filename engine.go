@@ -1,17 +1,18 @@
 package pgrest
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
-	"regexp"
 	"strings"
 
 	"github.com/aptogeo/pgrest/transactional"
+	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
-	"github.com/vmihailenco/msgpack/v5"
 )
 
 // Engine structure
@@ -40,9 +41,15 @@ func (e *Engine) Execute(restQuery *RestQuery) (interface{}, error) {
 	if err != nil {
 		return nil, &Error{Cause: err}
 	}
+	if restQuery.Threshold == 0 {
+		restQuery.Threshold = e.Config().Threshold()
+	}
 	var entity interface{}
 	var elem reflect.Value
 	if restQuery.Action == Get {
+		if err = e.applyQueryLimits(restQuery, resource); err != nil {
+			return nil, err
+		}
 		if restQuery.Key != "" {
 			elem = reflect.New(resource.ResourceType()).Elem()
 			entity = elem.Addr().Interface()
@@ -50,6 +57,9 @@ func (e *Engine) Execute(restQuery *RestQuery) (interface{}, error) {
 				return nil, NewErrorFromCause(restQuery, err)
 			}
 		} else {
+			if err = e.coerceSliceQuery(restQuery, resource); err != nil {
+				return nil, err
+			}
 			sliceType := reflect.MakeSlice(reflect.SliceOf(resource.ResourceType()), 0, 0).Type()
 			entity = reflect.New(sliceType).Interface()
 		}
@@ -57,8 +67,14 @@ func (e *Engine) Execute(restQuery *RestQuery) (interface{}, error) {
 		if restQuery.Key != "" {
 			return nil, NewErrorBadRequest("action 'Post': key is forbidden")
 		}
-		elem = reflect.New(resource.ResourceType()).Elem()
-		entity = elem.Addr().Interface()
+		if csvRegexp.MatchString(mediaTypeOf(restQuery.ContentType)) {
+			// CSV rows are bulk inserted
+			sliceType := reflect.MakeSlice(reflect.SliceOf(resource.ResourceType()), 0, 0).Type()
+			entity = reflect.New(sliceType).Interface()
+		} else {
+			elem = reflect.New(resource.ResourceType()).Elem()
+			entity = elem.Addr().Interface()
+		}
 		if err = e.Deserialize(restQuery, resource, entity); err != nil {
 			return nil, NewErrorFromCause(restQuery, err)
 		}
@@ -94,94 +110,244 @@ func (e *Engine) Execute(restQuery *RestQuery) (interface{}, error) {
 		return nil, &Error{Message: fmt.Sprintf("unknow action '%v'", restQuery.Action)}
 	}
 
-	var ctx context.Context
-	if restQuery.Request != nil {
-		ctx = restQuery.Request.Context()
-	}
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx = transactional.ContextWithDb(ctx, e.Config().DB())
-
 	executor := NewExecutor(restQuery, entity)
+	executor.SetResource(resource)
 
-	if restQuery.Action == Get {
-		if restQuery.Key != "" {
-			err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.GetOneExecFunc())
-		} else {
-			err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.GetSliceExecFunc())
-		}
-	} else if restQuery.Action == Post {
-		err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.InsertExecFunc())
-	} else if restQuery.Action == Put {
-		err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.UpdateExecFunc())
-	} else if restQuery.Action == Patch {
-		err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.GetOneExecFunc())
-		if err == nil {
-			err = e.Deserialize(restQuery, resource, entity)
-		}
-		if err == nil {
-			err = setPk(resource.ResourceType(), elem, restQuery.Key)
-		}
-		if err == nil {
+	restore := func() {}
+	if restQuery.Action != Get && e.Config().RetryPolicy() != nil {
+		restore = snapshotEntity(entity)
+	}
+	err = e.transaction(restQuery, func(ctx context.Context) error {
+		// Retried attempts start from entity as it was decoded (primary keys set by RETURNING are reset)
+		restore()
+		executor.count = 0
+		var err error
+		if restQuery.Action == Get {
+			if restQuery.Tile != nil {
+				err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.TileExecFunc())
+			} else if restQuery.Cluster != nil && restQuery.Key == "" {
+				err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.ClusterExecFunc())
+			} else if restQuery.Key != "" {
+				err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.GetOneExecFunc())
+			} else {
+				err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.GetSliceExecFunc())
+			}
+		} else if restQuery.Action == Post {
+			err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.InsertExecFunc())
+		} else if restQuery.Action == Put {
 			err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.UpdateExecFunc())
+		} else if restQuery.Action == Patch {
+			err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.getOneExecFunc(""))
+			if err == nil {
+				err = e.Deserialize(restQuery, resource, entity)
+			}
+			if err == nil {
+				err = setPk(resource.ResourceType(), elem, restQuery.Key)
+			}
+			if err == nil {
+				err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.UpdateExecFunc())
+			}
+		} else if restQuery.Action == Delete {
+			err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.DeleteExecFunc())
 		}
-	} else if restQuery.Action == Delete {
-		err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.DeleteExecFunc())
-	}
+		if err == nil && (restQuery.Action == Post || restQuery.Action == Put || restQuery.Action == Patch) && executor.geometryExpr() != "" {
+			// Reads written entity again to get geometry in accepted format
+			err = executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.GetOneExecFunc())
+		}
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	if restQuery.Debug {
 		e.Config().InfoLogger().Printf("Execution result %v\n", entity)
 	}
+	if restQuery.Tile != nil {
+		return executor.vectorTile, nil
+	}
+	if restQuery.Cluster != nil && restQuery.Key == "" {
+		return NewPage(&executor.clusters, executor.count, restQuery), nil
+	}
 	if restQuery.Action == Get && restQuery.Key == "" {
 		return NewPage(executor.entity, executor.count, restQuery), nil
 	}
 	return executor.entity, nil
 }
 
+// Stream executes a get slice rest query, rows are read from a cursor and written to writer
+// as they are fetched (one JSON object per line), has-many relations aren't supported
+func (e *Engine) Stream(restQuery *RestQuery, writer io.Writer) error {
+	if restQuery.Debug {
+		e.Config().InfoLogger().Printf("Stream request %v\n", restQuery)
+	}
+	resource, err := e.getResource(restQuery)
+	if err != nil {
+		return &Error{Cause: err}
+	}
+	if restQuery.Action != Get || restQuery.Key != "" || restQuery.Tile != nil || restQuery.Cluster != nil {
+		return NewErrorBadRequest("only get slice queries can be streamed")
+	}
+	if len(restQuery.Relations) > 0 {
+		return NewErrorParam("relations", errors.New("not supported by streamed responses"))
+	}
+	if restQuery.Threshold == 0 {
+		restQuery.Threshold = e.Config().Threshold()
+	}
+	if err = e.applyQueryLimits(restQuery, resource); err != nil {
+		return err
+	}
+	if err = e.coerceSliceQuery(restQuery, resource); err != nil {
+		return err
+	}
+	sliceType := reflect.MakeSlice(reflect.SliceOf(resource.ResourceType()), 0, 0).Type()
+	executor := NewExecutor(restQuery, reflect.New(sliceType).Interface())
+	executor.SetResource(resource)
+	buffered := bufio.NewWriter(writer)
+	encoder := json.NewEncoder(buffered)
+	err = e.transaction(restQuery, func(ctx context.Context) error {
+		return executor.ExecuteWithSearchPath(ctx, restQuery.SearchPath, executor.StreamExecFunc(func(entity interface{}) error {
+			return encoder.Encode(entity)
+		}))
+	})
+	if err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// coerceSliceQuery validates filter and converts filter, sort and aggregate values of get slice query
+func (e *Engine) coerceSliceQuery(restQuery *RestQuery, resource *Resource) error {
+	table := orm.GetTable(resource.ResourceType())
+	if restQuery.Filter != nil {
+		if err := restQuery.Filter.Validate(); err != nil {
+			return NewErrorParam("filter", err)
+		}
+	}
+	if err := coerceFilter(table, restQuery.Filter, restQuery.inputSRID()); err != nil {
+		return err
+	}
+	if err := coerceDistanceSorts(table, restQuery.Sorts, restQuery.inputSRID()); err != nil {
+		return err
+	}
+	if restQuery.Cluster != nil {
+		if err := coerceAggregates(table, restQuery.Cluster.Aggregates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// context gets request context with database, request cancellation cancels queries
+func (e *Engine) context(restQuery *RestQuery) context.Context {
+	var ctx context.Context
+	if restQuery.Request != nil {
+		ctx = restQuery.Request.Context()
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return transactional.ContextWithDb(ctx, e.Config().DB())
+}
+
+// transaction executes fn in transaction of rest query, get queries are read-only unless they
+// join a current transaction (request transaction of middleware, ...) and other queries are
+// retried with retry policy when they start transaction
+func (e *Engine) transaction(restQuery *RestQuery, fn func(ctx context.Context) error) error {
+	return e.transactionWithRetry(restQuery, e.Config().RetryPolicy(), fn)
+}
+
+// transactionWithRetry executes function in transaction, write queries are retried with policy (nil for no retry)
+func (e *Engine) transactionWithRetry(restQuery *RestQuery, retryPolicy *transactional.RetryPolicy, fn func(ctx context.Context) error) error {
+	ctx := e.context(restQuery)
+	opts := transactional.Options{}
+	if restQuery.Action == Get && e.Config().ReadOnlyGet() && transactional.TxFromContext(ctx) == nil {
+		opts.ReadOnly = true
+	} else if restQuery.Action != Get {
+		opts.Retry = retryPolicy
+	}
+	err := transactional.ExecuteWithOptions(ctx, opts, func(ctx context.Context, tx *pg.Tx) error {
+		return fn(ctx)
+	})
+	var cerr *Error
+	if errors.As(err, &cerr) {
+		// Transactional errors wrap errors of execution functions
+		return cerr
+	}
+	return err
+}
+
+// snapshotEntity copies entity, or elements of slice entity, and gets function restoring copy
+func snapshotEntity(entity interface{}) func() {
+	value := reflect.ValueOf(entity).Elem()
+	saved := reflect.New(value.Type()).Elem()
+	if value.Kind() == reflect.Slice {
+		saved.Set(reflect.MakeSlice(value.Type(), value.Len(), value.Len()))
+		reflect.Copy(saved, value)
+		return func() {
+			reflect.Copy(value, saved)
+		}
+	}
+	saved.Set(value)
+	return func() {
+		value.Set(saved)
+	}
+}
+
 // Deserialize deserializes data into entity
 func (e *Engine) Deserialize(restQuery *RestQuery, resource *Resource, entity interface{}) error {
-	if regexp.MustCompile("[+-/]json($|[+-;])").MatchString(restQuery.ContentType) {
-		if err := json.Unmarshal(restQuery.Content, entity); err != nil {
-			return &Error{Cause: err}
-		}
-	} else if regexp.MustCompile("[+-/]form($|[+-;])").MatchString(restQuery.ContentType) {
-		table := orm.GetTable(resource.ResourceType())
-		keyValues := strings.Split(string(restQuery.Content), "&")
-		elem := reflect.ValueOf(entity).Elem()
-		for _, keyValue := range keyValues {
-			parts := strings.Split(keyValue, "=")
-			if parts != nil && len(parts) == 2 {
-				found := false
-				for _, field := range table.Fields {
-					if field.GoName == parts[0] {
-						field.ScanValue(elem, NewBytesReader([]byte(parts[1])), len(parts[1]))
-						found = true
-					}
-				}
-				if !found {
-					for _, field := range table.Fields {
-						if field.SQLName == parts[0] {
-							field.ScanValue(elem, NewBytesReader([]byte(parts[1])), len(parts[1]))
-							found = true
-						}
-					}
-				}
+	codec, err := e.Config().decodingCodec(restQuery.ContentType)
+	if err != nil {
+		return err
+	}
+	if err = codec.Decode(restQuery, resource, restQuery.Content, entity); err == ErrUnsupported {
+		return NewErrorUnsupportedMediaType(fmt.Sprintf("content type '%v' can't be decoded", restQuery.ContentType))
+	} else if cerr, ok := err.(*Error); ok {
+		return cerr
+	} else if err != nil {
+		return &Error{Cause: err}
+	}
+	if restQuery.Debug {
+		e.Config().InfoLogger().Printf("Serialized response in %v: %v\n", restQuery.ContentType, entity)
+	}
+	return nil
+}
+
+// applyQueryLimits checks relation depth, clamps limit and sets default sorts according to resource
+func (e *Engine) applyQueryLimits(restQuery *RestQuery, resource *Resource) error {
+	if maxRelationDepth := e.Config().resourceMaxRelationDepth(resource); maxRelationDepth > 0 {
+		for _, relation := range restQuery.Relations {
+			if strings.Count(relation.Name, ".")+1 > maxRelationDepth {
+				return NewErrorParam("relations", fmt.Errorf("relation '%v' exceeds maximum depth %v", relation.Name, maxRelationDepth))
 			}
 		}
-	} else if regexp.MustCompile("[+-/](msgpack|messagepack)($|[+-])").MatchString(restQuery.ContentType) {
-		decoder := msgpack.NewDecoder(bytes.NewReader(restQuery.Content))
-		decoder.SetCustomStructTag("json")
-		if err := decoder.Decode(entity); err != nil {
-			return &Error{Cause: err}
+	}
+	if restQuery.Key != "" {
+		return nil
+	}
+	maxLimit := e.Config().resourceMaxLimit(resource)
+	if csvRegexp.MatchString(restQuery.Accept) || xlsxRegexp.MatchString(restQuery.Accept) {
+		maxLimit = e.Config().CSVMaxLimit()
+	} else if ndjsonRegexp.MatchString(restQuery.Accept) {
+		maxLimit = e.Config().StreamMaxLimit()
+	}
+	if maxLimit > 0 && (restQuery.Limit == 0 || restQuery.Limit > maxLimit) {
+		if resource.StrictLimit() {
+			return NewErrorParam("limit", fmt.Errorf("must be between 1 and %v", maxLimit))
 		}
-	} else {
-		return NewErrorBadRequest(fmt.Sprintf("Unknown content type '%v'", restQuery.ContentType))
+		restQuery.Limit = maxLimit
 	}
-	if restQuery.Debug {
-		e.Config().InfoLogger().Printf("Serialized response in %v: %v\n", restQuery.ContentType, entity)
+	if len(restQuery.Sorts) == 0 {
+		if len(resource.DefaultSorts()) > 0 {
+			// Sorts are copied, coercion rewrites sorts of query
+			for _, defaultSort := range resource.DefaultSorts() {
+				sort := *defaultSort
+				restQuery.Sorts = append(restQuery.Sorts, &sort)
+			}
+		} else {
+			for _, pk := range orm.GetTable(resource.ResourceType()).PKs {
+				restQuery.Sorts = append(restQuery.Sorts, &Sort{Name: pk.SQLName, Asc: true})
+			}
+		}
 	}
 	return nil
 }
@@ -1,16 +1,22 @@
 package pgrest_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	"github.com/google/uuid"
 
 	"github.com/vmihailenco/msgpack/v5"
 
 	"github.com/aptogeo/pgrest"
+	"github.com/aptogeo/pgrest/transactional"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -249,6 +255,30 @@ func TestMsgpack(t *testing.T) {
 	assert.Equal(t, resAuthor.Picture, []byte{187, 163, 35, 30})
 }
 
+func TestCBOR(t *testing.T) {
+	db, config := initTests(t)
+	defer db.Close()
+	engine := pgrest.NewEngine(config)
+
+	var err error
+	var content []byte
+	var res interface{}
+	var resAuthor *Author
+
+	resAuthor = &Author{Firstname: "CBORFirstname", Lastname: "CBORLastname", Picture: []byte{187, 163, 35, 30}}
+	content, err = pgrest.CBORCodec{}.Encode(nil, nil, resAuthor)
+	assert.Nil(t, err)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "application/cbor", Content: content})
+	assert.Nil(t, err)
+	assert.NotNil(t, res)
+	resAuthor = res.(*Author)
+	assert.NotEqual(t, resAuthor.ID, 0)
+	assert.Equal(t, resAuthor.Firstname, "CBORFirstname")
+	assert.Equal(t, resAuthor.Lastname, "CBORLastname")
+	assert.Equal(t, resAuthor.Picture, []byte{187, 163, 35, 30})
+}
+
 func TestSearchPath(t *testing.T) {
 	db, _ := initTests(t)
 	defer db.Close()
@@ -297,3 +327,396 @@ func TestSearchPath(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "\"$user\", public", searchPathDB)
 }
+
+func TestSimilar(t *testing.T) {
+	db, config := initTests(t)
+	defer db.Close()
+	engine := pgrest.NewEngine(config)
+
+	var err error
+	var content []byte
+	var res interface{}
+	var page pgrest.Page
+	var resAuthors []Author
+
+	_, err = db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm")
+	assert.Nil(t, err)
+
+	for _, author := range authors {
+		content, err = json.Marshal(author)
+		assert.Nil(t, err)
+		_, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "application/json", Content: content})
+		assert.Nil(t, err)
+	}
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Author", Filter: &pgrest.Filter{Op: pgrest.Similar, Attr: "lastname", Value: "Kafak"}})
+	assert.Nil(t, err)
+	assert.NotNil(t, res)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 1)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Author", Sorts: []*pgrest.Sort{{Name: "lastname", Asc: true, Func: pgrest.Similarity, Value: "Fitzgeral", Alias: "score"}}})
+	assert.Nil(t, err)
+	assert.NotNil(t, res)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 3)
+	resAuthors = *page.Slice.(*[]Author)
+	assert.Equal(t, resAuthors[0].Lastname, "Fitzgerald")
+	assert.True(t, resAuthors[0].Score > resAuthors[1].Score)
+
+	// Threshold of query doesn't leak into enclosing transaction
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	defer tx.Rollback()
+	var threshold string
+	_, err = tx.QueryOne(pg.Scan(&threshold), "SELECT set_config('pg_trgm.similarity_threshold', '0.3', true)")
+	assert.Nil(t, err)
+	req := httptest.NewRequest("GET", "/rest/Author", nil)
+	req = req.WithContext(transactional.ContextWithTx(transactional.ContextWithDb(req.Context(), db), tx))
+	res, err = engine.Execute(&pgrest.RestQuery{Request: req, Action: pgrest.Get, Resource: "Author", Threshold: 0.9, Filter: &pgrest.Filter{Op: pgrest.Similar, Attr: "lastname", Value: "Kafak"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, res.(*pgrest.Page).Count)
+	_, err = tx.QueryOne(pg.Scan(&threshold), "SELECT current_setting('pg_trgm.similarity_threshold')")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.3", threshold)
+}
+
+type TicketStatus string
+
+func (TicketStatus) EnumValues() []string {
+	return []string{"open", "closed"}
+}
+
+type Ticket struct {
+	ID       int
+	Status   *TicketStatus
+	Priority *int
+	Urgent   *bool
+	ClosedAt *time.Time
+}
+
+func TestCoerceFilter(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	config.AddResource(pgrest.NewResource("Book", (*Book)(nil), pgrest.All))
+	config.AddResource(pgrest.NewResource("Todo", (*Todo)(nil), pgrest.All))
+	engine := pgrest.NewEngine(config)
+
+	var err error
+	var filter *pgrest.Filter
+
+	filter = &pgrest.Filter{Op: pgrest.Gt, Attr: "nb_pages", Value: "abc"}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Filter: filter})
+	assert.IsType(t, &pgrest.Error{}, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+	assert.Contains(t, err.Error(), "nb_pages")
+
+	filter = &pgrest.Filter{Op: pgrest.And, Filters: []*pgrest.Filter{{Op: pgrest.Gte, Attr: "NbPages", Value: "100"}, {Op: pgrest.In, Attr: "author_id", Value: []interface{}{1.0, "2"}}, {Op: pgrest.Eq, Attr: "title", Value: 12.0}}}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Filter: filter})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), filter.Filters[0].Value)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, filter.Filters[1].Value)
+	assert.Equal(t, "12", filter.Filters[2].Value)
+
+	filter = &pgrest.Filter{Op: pgrest.In, Attr: "author_id", Value: "1,2"}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Filter: filter})
+	assert.IsType(t, &pgrest.Error{}, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+
+	filter = &pgrest.Filter{Op: pgrest.Eq, Attr: "id", Value: "not-a-uuid"}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Todo", Filter: filter})
+	assert.IsType(t, &pgrest.Error{}, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+	assert.Contains(t, err.Error(), "'id'")
+
+	// JSON numbers beyond float64 precision are rejected, strings keep precision
+	filter = &pgrest.Filter{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"Op":"eq","Attr":"id","Value":9007199254740993}`), filter))
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Filter: filter})
+	assert.IsType(t, &pgrest.Error{}, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+	filter = &pgrest.Filter{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"Op":"eq","Attr":"id","Value":"9007199254740993"}`), filter))
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Filter: filter})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9007199254740993), filter.Value)
+
+	// Nullable fields are coerced as their element type
+	config.AddResource(pgrest.NewResource("Ticket", (*Ticket)(nil), pgrest.All))
+	filter = &pgrest.Filter{Op: pgrest.And, Filters: []*pgrest.Filter{{Op: pgrest.Eq, Attr: "status", Value: "open"}, {Op: pgrest.Gt, Attr: "priority", Value: "2"}, {Op: pgrest.Eq, Attr: "urgent", Value: "true"}, {Op: pgrest.Lt, Attr: "closed_at", Value: "2020-01-02T00:00:00Z"}}}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Ticket", Filter: filter})
+	assert.Nil(t, err)
+	assert.Equal(t, "open", filter.Filters[0].Value)
+	assert.Equal(t, int64(2), filter.Filters[1].Value)
+	assert.Equal(t, true, filter.Filters[2].Value)
+	assert.Equal(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), filter.Filters[3].Value)
+
+	filter = &pgrest.Filter{Op: pgrest.Eq, Attr: "status", Value: "pending"}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Ticket", Filter: filter})
+	assert.IsType(t, &pgrest.Error{}, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+
+	filter = &pgrest.Filter{Op: pgrest.Gt, Attr: "priority", Value: "high"}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Ticket", Filter: filter})
+	assert.IsType(t, &pgrest.Error{}, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+}
+
+func TestCoerceSpatialFilter(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	config.AddResource(pgrest.NewResource("Place", (*Place)(nil), pgrest.All))
+	engine := pgrest.NewEngine(config)
+
+	var err error
+	var filter *pgrest.Filter
+
+	filter = &pgrest.Filter{Op: pgrest.Bbox, Attr: "geom", Value: "2.2,48.8,2.5,48.9"}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Filter: filter})
+	assert.Nil(t, err)
+	assert.Equal(t, &pgrest.Envelope{MinX: 2.2, MinY: 48.8, MaxX: 2.5, MaxY: 48.9, SRID: 4326}, filter.Value)
+
+	filter = &pgrest.Filter{Op: pgrest.Bbox, Attr: "geom", Value: "2.2,48.8,2.5"}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Filter: filter})
+	assert.IsType(t, &pgrest.Error{}, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+}
+
+func TestCoerceDistanceSort(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	config.AddResource(pgrest.NewResource("Place", (*Place)(nil), pgrest.All))
+	engine := pgrest.NewEngine(config)
+
+	var err error
+
+	sorts := []*pgrest.Sort{{Name: "Geom", Asc: true, Func: pgrest.Distance, Value: "POINT(2.35 48.85)"}}
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Sorts: sorts})
+	assert.Nil(t, err)
+	assert.Equal(t, "geom", sorts[0].Name)
+	assert.Equal(t, &pgrest.Geometry{WKT: "POINT(2.35 48.85)", SRID: 4326}, sorts[0].Value)
+
+	err = engine.CoerceSliceQuery(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Sorts: []*pgrest.Sort{{Name: "name", Asc: true, Func: pgrest.Distance, Value: "POINT(2.35 48.85)"}}})
+	assert.IsType(t, &pgrest.Error{}, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+	assert.Equal(t, "sort", err.(*pgrest.Error).Param)
+}
+
+func TestQueryLimits(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	config.SetMaxRelationDepth(1)
+	resource := pgrest.NewResource("Book", (*Book)(nil), pgrest.All)
+	resource.SetMaxLimit(50)
+	config.AddResource(resource)
+	engine := pgrest.NewEngine(config)
+
+	var err error
+	var restQuery *pgrest.RestQuery
+
+	restQuery = &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Limit: 0}
+	engine.Execute(restQuery)
+	assert.Equal(t, 50, restQuery.Limit)
+	assert.Equal(t, []*pgrest.Sort{{Name: "id", Asc: true}}, restQuery.Sorts)
+
+	restQuery = &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Limit: 1000}
+	engine.Execute(restQuery)
+	assert.Equal(t, 50, restQuery.Limit)
+
+	// Default maximum limit applies to resources without maximum limit
+	resource.SetMaxLimit(0)
+	restQuery = &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Limit: 10000000}
+	engine.Execute(restQuery)
+	assert.Equal(t, 1000, restQuery.Limit)
+	restQuery = &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Limit: 0}
+	engine.Execute(restQuery)
+	assert.Equal(t, 1000, restQuery.Limit)
+	resource.SetMaxLimit(50)
+
+	config.SetCSVMaxLimit(500)
+	restQuery = &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Accept: "text/csv", Limit: 1000}
+	engine.Execute(restQuery)
+	assert.Equal(t, 500, restQuery.Limit)
+
+	restQuery = &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Accept: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Limit: 1000}
+	engine.Execute(restQuery)
+	assert.Equal(t, 500, restQuery.Limit)
+
+	config.SetStreamMaxLimit(2000)
+	restQuery = &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Accept: "application/x-ndjson", Limit: 5000}
+	engine.Execute(restQuery)
+	assert.Equal(t, 2000, restQuery.Limit)
+
+	resource.SetDefaultSorts(&pgrest.Sort{Name: "title", Asc: false})
+	restQuery = &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Limit: 20}
+	engine.Execute(restQuery)
+	assert.Equal(t, 20, restQuery.Limit)
+	assert.Equal(t, []*pgrest.Sort{{Name: "title", Asc: false}}, restQuery.Sorts)
+
+	resource.SetStrictLimit(true)
+	_, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Limit: 1000})
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+	assert.Equal(t, "limit", err.(*pgrest.Error).Param)
+
+	_, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Key: "1", Relations: []*pgrest.Relation{{Name: "Author.Books"}}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+	assert.Equal(t, "relations", err.(*pgrest.Error).Param)
+
+	// Default sorts aren't rewritten by coercion of queries
+	place := pgrest.NewResource("Place", (*Place)(nil), pgrest.All)
+	place.SetDefaultSorts(&pgrest.Sort{Name: "Geom", Asc: true, Func: pgrest.Distance, Value: "POINT(2.35 48.85)"})
+	config.AddResource(place)
+	for i := 0; i < 2; i++ {
+		restQuery = &pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Crs: 3857}
+		engine.Execute(restQuery)
+		assert.Equal(t, "geom", restQuery.Sorts[0].Name)
+		assert.Equal(t, &pgrest.Geometry{WKT: "POINT(2.35 48.85)", SRID: 3857}, restQuery.Sorts[0].Value)
+		assert.NotSame(t, place.DefaultSorts()[0], restQuery.Sorts[0])
+	}
+	assert.Equal(t, []*pgrest.Sort{{Name: "Geom", Asc: true, Func: pgrest.Distance, Value: "POINT(2.35 48.85)"}}, place.DefaultSorts())
+}
+
+func TestSpatialFilter(t *testing.T) {
+	db, config := initTests(t)
+	defer db.Close()
+	engine := pgrest.NewEngine(config)
+
+	var err error
+	var res interface{}
+	var page pgrest.Page
+
+	_, err = db.Exec("CREATE EXTENSION IF NOT EXISTS postgis")
+	assert.Nil(t, err)
+	err = db.Model((*Place)(nil)).CreateTable(&orm.CreateTableOptions{Temp: true})
+	assert.Nil(t, err)
+	_, err = db.Exec("INSERT INTO places (name, geom) VALUES ('Eiffel', ST_SetSRID(ST_MakePoint(2.2945, 48.8584), 4326)), ('Louvre', ST_SetSRID(ST_MakePoint(2.3376, 48.8606), 4326)), ('Colosseo', ST_SetSRID(ST_MakePoint(12.4922, 41.8902), 4326))")
+	assert.Nil(t, err)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Filter: &pgrest.Filter{Op: pgrest.Bbox, Attr: "geom", Value: "2.2,48.8,2.5,48.9"}})
+	assert.Nil(t, err)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 2)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Filter: &pgrest.Filter{Op: pgrest.Dwithin, Attr: "geom", Value: []interface{}{map[string]interface{}{"type": "Point", "coordinates": []interface{}{2.2945, 48.8584}}, 0.01}}})
+	assert.Nil(t, err)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 1)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Filter: &pgrest.Filter{Op: pgrest.Within, Attr: "geom", Value: "POLYGON((10 40, 15 40, 15 45, 10 45, 10 40))"}})
+	assert.Nil(t, err)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 1)
+
+	_, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Filter: &pgrest.Filter{Op: pgrest.Intersects, Attr: "geom", Value: 12}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+
+	// Filters of executors aren't coerced, invalid values are rejected when query is built
+	executor := pgrest.NewExecutor(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Filter: &pgrest.Filter{Op: pgrest.Bbox, Attr: "geom", Value: "2.2,48.8"}}, &[]Place{})
+	executor.SetResource(config.GetResource("Place"))
+	err = executor.ExecuteWithSearchPath(transactional.ContextWithDb(context.Background(), db), "", executor.GetSliceExecFunc())
+	var perr *pgrest.Error
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, 400, perr.StatusCode())
+	assert.Equal(t, "filter", perr.Param)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Limit: 2, Sorts: []*pgrest.Sort{{Name: "geom", Asc: true, Func: pgrest.Distance, Value: "POINT(2.35 48.85)", Alias: "distance"}}})
+	assert.Nil(t, err)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 3)
+	places := *page.Slice.(*[]Place)
+	assert.Equal(t, len(places), 2)
+	assert.Equal(t, places[0].Name, "Louvre")
+	assert.Equal(t, places[1].Name, "Eiffel")
+	assert.True(t, places[0].Distance > 0 && places[0].Distance < places[1].Distance)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Sorts: []*pgrest.Sort{{Name: "geom", Asc: true, Func: pgrest.Distance, Value: "POINT(2.35 48.85)"}}, Filter: &pgrest.Filter{Op: pgrest.Dwithin, Attr: "geom", Value: []interface{}{"POINT(2.35 48.85)", 1.0}}})
+	assert.Nil(t, err)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 2)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Crs: 3857, Filter: &pgrest.Filter{Op: pgrest.Bbox, Attr: "geom", Value: "255000,6240000,258000,6255000"}})
+	assert.Nil(t, err)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 1)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Place", Crs: 3857, ContentType: "application/json", Content: []byte(`{"Name":"Notre-Dame","Geom":"POINT(261700 6250000)"}`)})
+	assert.Nil(t, err)
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Key: strconv.Itoa(res.(*Place).ID), Accept: "application/geo+json"})
+	assert.Nil(t, err)
+	assert.Contains(t, res.(*Place).Geom, `"coordinates":[2.35`)
+}
+
+func TestVectorTile(t *testing.T) {
+	db, config := initTests(t)
+	defer db.Close()
+	engine := pgrest.NewEngine(config)
+
+	var err error
+	var res interface{}
+
+	_, err = db.Exec("CREATE EXTENSION IF NOT EXISTS postgis")
+	assert.Nil(t, err)
+	err = db.Model((*Place)(nil)).CreateTable(&orm.CreateTableOptions{Temp: true})
+	assert.Nil(t, err)
+	_, err = db.Exec("INSERT INTO places (name, geom) VALUES ('Eiffel', ST_SetSRID(ST_MakePoint(2.2945, 48.8584), 4326)), ('Louvre', ST_SetSRID(ST_MakePoint(2.3376, 48.8606), 4326))")
+	assert.Nil(t, err)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Tile: &pgrest.Tile{Z: 12, X: 2074, Y: 1409}})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, res.(pgrest.VectorTile))
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Tile: &pgrest.Tile{Z: 12, X: 2074, Y: 1409}, Filter: &pgrest.Filter{Op: pgrest.Eq, Attr: "name", Value: "Colosseo"}})
+	assert.Nil(t, err)
+	assert.Empty(t, res.(pgrest.VectorTile))
+
+	config.GetResource("Place").SetMaxZoom(10)
+	defer config.GetResource("Place").SetMaxZoom(0)
+	_, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Tile: &pgrest.Tile{Z: 12, X: 2074, Y: 1409}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 404, err.(*pgrest.Error).StatusCode())
+}
+
+func TestCluster(t *testing.T) {
+	db, config := initTests(t)
+	defer db.Close()
+	engine := pgrest.NewEngine(config)
+
+	var err error
+	var res interface{}
+	var page pgrest.Page
+	var clusters []pgrest.ClusterItem
+
+	_, err = db.Exec("CREATE EXTENSION IF NOT EXISTS postgis")
+	assert.Nil(t, err)
+	err = db.Model((*Place)(nil)).CreateTable(&orm.CreateTableOptions{Temp: true})
+	assert.Nil(t, err)
+	_, err = db.Exec("INSERT INTO places (name, geom) VALUES ('Eiffel', ST_SetSRID(ST_MakePoint(2.2945, 48.8584), 4326)), ('Louvre', ST_SetSRID(ST_MakePoint(2.3376, 48.8606), 4326)), ('Colosseo', ST_SetSRID(ST_MakePoint(12.4922, 41.8902), 4326))")
+	assert.Nil(t, err)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Accept: "application/geo+json", Cluster: &pgrest.Cluster{Method: pgrest.Grid, CellSize: 1, Aggregates: []*pgrest.Aggregate{{Func: pgrest.Max, Name: "Name"}}}})
+	assert.Nil(t, err)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 2)
+	clusters = *page.Slice.(*[]pgrest.ClusterItem)
+	assert.Equal(t, clusters[0].Count, 2)
+	assert.Equal(t, clusters[0].Aggregates["max_name"], "Louvre")
+	assert.Contains(t, clusters[0].Geometry, `"type":"Point"`)
+
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Cluster: &pgrest.Cluster{Method: pgrest.Kmeans, K: 50}, Filter: &pgrest.Filter{Op: pgrest.Bbox, Attr: "geom", Value: "2.2,48.8,2.5,48.9"}})
+	assert.Nil(t, err)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, page.Count, 2)
+
+	config.GetResource("Place").SetMaxLimit(1)
+	defer config.GetResource("Place").SetMaxLimit(0)
+	res, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Offset: 1, Limit: 10, Cluster: &pgrest.Cluster{Method: pgrest.Grid, CellSize: 0.0001}})
+	assert.Nil(t, err)
+	page = *res.(*pgrest.Page)
+	assert.Equal(t, 3, page.Count)
+	assert.Equal(t, 1, page.Offset)
+	assert.Equal(t, 1, page.Limit)
+	assert.Len(t, *page.Slice.(*[]pgrest.ClusterItem), 1)
+
+	_, err = engine.Execute(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Cluster: &pgrest.Cluster{Method: pgrest.Grid, CellSize: 1, Aggregates: []*pgrest.Aggregate{{Func: pgrest.Sum, Name: "unknown"}}}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+}
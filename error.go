@@ -7,6 +7,7 @@ type Error struct {
 	Message string
 	Cause   error
 	Code    int
+	Param   string // request parameter at the origin of error
 }
 
 // NewErrorBadRequest constructs Error with bad request code
@@ -19,6 +20,31 @@ func NewErrorForbbiden(message string) *Error {
 	return &Error{Message: message, Code: 403}
 }
 
+// NewErrorParam constructs Error with bad request code for invalid request parameter
+func NewErrorParam(param string, cause error) *Error {
+	return &Error{Message: fmt.Sprintf("invalid parameter '%v'", param), Code: 400, Param: param, Cause: cause}
+}
+
+// NewErrorNotAcceptable constructs Error with not acceptable code
+func NewErrorNotAcceptable(message string) *Error {
+	return &Error{Message: message, Code: 406}
+}
+
+// NewErrorUnsupportedMediaType constructs Error with unsupported media type code
+func NewErrorUnsupportedMediaType(message string) *Error {
+	return &Error{Message: message, Code: 415}
+}
+
+// NewErrorRequestTooLarge constructs Error with request entity too large code
+func NewErrorRequestTooLarge(message string) *Error {
+	return &Error{Message: message, Code: 413}
+}
+
+// NewErrorNotImplemented constructs Error with not implemented code
+func NewErrorNotImplemented(message string) *Error {
+	return &Error{Message: message, Code: 501}
+}
+
 // NewErrorFromCause constructs Error from cause error
 func NewErrorFromCause(restQuery *RestQuery, cause error) *Error {
 	errStr := cause.Error()
@@ -37,6 +63,11 @@ func (e Error) Error() string {
 	return msg
 }
 
+// Unwrap gets cause
+func (e Error) Unwrap() error {
+	return e.Cause
+}
+
 // StatusCode returns code
 func (e Error) StatusCode() int {
 	if e.Code != 0 {
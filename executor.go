@@ -2,6 +2,10 @@ package pgrest
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/aptogeo/pgrest/transactional"
@@ -12,8 +16,11 @@ import (
 // Executor structure
 type Executor struct {
 	restQuery          *RestQuery
+	resource           *Resource
 	entity             interface{}
 	count              int
+	vectorTile         VectorTile
+	clusters           []ClusterItem
 	originalSearchPath string
 }
 
@@ -26,6 +33,16 @@ func NewExecutor(restQuery *RestQuery, entity interface{}) *Executor {
 	return e
 }
 
+// SetResource sets resource used for geometry field and table metadata
+func (e *Executor) SetResource(resource *Resource) {
+	e.resource = resource
+}
+
+// Resource gets resource
+func (e *Executor) Resource() *Resource {
+	return e.resource
+}
+
 // GetSearchPath gets search path
 func (e *Executor) GetSearchPath(ctx context.Context) (string, error) {
 	var searchPath string
@@ -71,9 +88,14 @@ func (e *Executor) ExecuteWithSearchPath(ctx context.Context, searchPath string,
 
 // GetOneExecFunc gets one execution function
 func (e *Executor) GetOneExecFunc() transactional.ExecFunc {
+	return e.getOneExecFunc(e.geometryExpr())
+}
+
+// getOneExecFunc gets one execution function selecting geometry field with geometry expression (raw if empty)
+func (e *Executor) getOneExecFunc(geometryExpr string) transactional.ExecFunc {
 	return func(ctx context.Context, tx *pg.Tx) error {
 		q := tx.ModelContext(ctx, e.entity).WherePK()
-		q = addQueryFields(q, e.restQuery.Fields)
+		q = e.addQueryColumns(q, nil, geometryExpr)
 		q = addQueryRelations(q, e.restQuery.Relations)
 		if err := q.Select(); err != nil {
 			return NewErrorFromCause(e.restQuery, err)
@@ -86,13 +108,11 @@ func (e *Executor) GetOneExecFunc() transactional.ExecFunc {
 // GetSliceExecFunc gets slice execution function
 func (e *Executor) GetSliceExecFunc() transactional.ExecFunc {
 	return func(ctx context.Context, tx *pg.Tx) error {
-		var err error
-		q := tx.ModelContext(ctx, e.entity)
-		q = addQueryLimit(q, e.restQuery.Limit)
-		q = addQueryOffset(q, e.restQuery.Offset)
-		q = addQueryFields(q, e.restQuery.Fields)
-		q = addQuerySorts(q, e.restQuery.Sorts)
-		q = addQueryFilter(q, e.restQuery.Filter, And)
+		q, restore, err := e.sliceQuery(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer restore()
 		e.count, err = q.Count()
 		if err != nil {
 			return NewErrorFromCause(e.restQuery, err)
@@ -107,22 +127,145 @@ func (e *Executor) GetSliceExecFunc() transactional.ExecFunc {
 	}
 }
 
-// InsertExecFunc inserts execution function
-func (e *Executor) InsertExecFunc() transactional.ExecFunc {
+// StreamExecFunc gets slice execution function reading rows from a cursor, fn is called for each row
+func (e *Executor) StreamExecFunc(fn func(entity interface{}) error) transactional.ExecFunc {
 	return func(ctx context.Context, tx *pg.Tx) error {
-		q := orm.NewQueryContext(ctx, tx, e.entity)
-		if _, err := q.Insert(); err != nil {
+		q, restore, err := e.sliceQuery(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer restore()
+		cursor := pg.Ident("pgrest_stream")
+		if _, err = tx.ExecContext(ctx, "DECLARE ? NO SCROLL CURSOR FOR ?", cursor, q); err != nil {
 			return NewErrorFromCause(e.restQuery, err)
 		}
-		e.count = 1
+		sliceType := reflect.TypeOf(e.entity).Elem()
+		for {
+			// Each batch is a new slice, memory is bounded by fetch size
+			batch := reflect.New(sliceType)
+			res, err := tx.QueryContext(ctx, batch.Interface(), "FETCH ? FROM ?", streamFetchSize, cursor)
+			if err != nil {
+				return NewErrorFromCause(e.restQuery, err)
+			}
+			slice := batch.Elem()
+			for i := 0; i < slice.Len(); i++ {
+				if err = fn(slice.Index(i).Addr().Interface()); err != nil {
+					return err
+				}
+			}
+			e.count += slice.Len()
+			if res.RowsReturned() < streamFetchSize {
+				break
+			}
+		}
+		_, err = tx.ExecContext(ctx, "CLOSE ?", cursor)
+		return err
+	}
+}
+
+// sliceQuery gets slice query with limit, offset, columns, sorts and filter, and function restoring
+// similarity thresholds of transaction once query is executed
+func (e *Executor) sliceQuery(ctx context.Context, tx *pg.Tx) (*orm.Query, func(), error) {
+	var err error
+	restore := func() {}
+	if usesTrigram(e.restQuery.Filter, e.restQuery.Sorts) {
+		if err = checkExtension(ctx, tx, "pg_trgm"); err != nil {
+			return nil, nil, err
+		}
+		if e.restQuery.Threshold > 0 {
+			if restore, err = e.setThresholds(ctx, tx); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if usesPostgis(e.restQuery.Filter, e.restQuery.Sorts) {
+		if err = checkExtension(ctx, tx, "postgis"); err != nil {
+			restore()
+			return nil, nil, err
+		}
+		if err = e.transformSpatialValues(ctx, tx); err != nil {
+			restore()
+			return nil, nil, err
+		}
+	}
+	q := tx.ModelContext(ctx, e.entity)
+	q = addQueryLimit(q, e.restQuery.Limit)
+	q = addQueryOffset(q, e.restQuery.Offset)
+	q = e.addQueryColumns(q, e.restQuery.Sorts, e.geometryExpr())
+	q = addQuerySorts(q, e.restQuery.Sorts)
+	if q, err = addQueryFilter(q, e.restQuery.Filter, And); err != nil {
+		restore()
+		return nil, nil, err
+	}
+	return q, restore, nil
+}
+
+// setThresholds sets similarity thresholds of rest query in a savepoint and gets function rolling
+// savepoint back, restoring thresholds of transaction once read query is executed
+func (e *Executor) setThresholds(ctx context.Context, tx *pg.Tx) (func(), error) {
+	savepoint := pg.Ident("pgrest_threshold")
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT ?", savepoint); err != nil {
+		return nil, NewErrorFromCause(e.restQuery, err)
+	}
+	restore := func() {
+		tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT ?", savepoint)
+		tx.ExecContext(ctx, "RELEASE SAVEPOINT ?", savepoint)
+	}
+	threshold := strconv.FormatFloat(e.restQuery.Threshold, 'f', -1, 64)
+	if _, err := tx.ExecContext(ctx, "SELECT set_config('pg_trgm.similarity_threshold', ?, true), set_config('pg_trgm.word_similarity_threshold', ?, true)", threshold, threshold); err != nil {
+		restore()
+		return nil, NewErrorFromCause(e.restQuery, err)
+	}
+	return restore, nil
+}
+
+// InsertExecFunc inserts execution function, slice entity is inserted row by row
+func (e *Executor) InsertExecFunc() transactional.ExecFunc {
+	return func(ctx context.Context, tx *pg.Tx) error {
+		slice := reflect.ValueOf(e.entity).Elem()
+		if slice.Kind() != reflect.Slice {
+			if err := e.insert(ctx, tx, e.entity); err != nil {
+				return err
+			}
+			e.count = 1
+			return nil
+		}
+		for i := 0; i < slice.Len(); i++ {
+			if err := e.insert(ctx, tx, slice.Index(i).Addr().Interface()); err != nil {
+				// Rows are numbered by start line in bulk content, or as lines after header line
+				line := i + 2
+				if i < len(e.restQuery.lines) {
+					line = e.restQuery.lines[i]
+				}
+				return &Error{Message: fmt.Sprintf("line %d", line), Cause: err}
+			}
+		}
+		e.count = slice.Len()
 		return nil
 	}
 }
 
+// insert inserts entity
+func (e *Executor) insert(ctx context.Context, tx *pg.Tx, entity interface{}) error {
+	q := orm.NewQueryContext(ctx, tx, entity)
+	q, err := e.addQueryGeometryValue(ctx, tx, q, entity)
+	if err != nil {
+		return err
+	}
+	if _, err := q.Insert(); err != nil {
+		return NewErrorFromCause(e.restQuery, err)
+	}
+	return nil
+}
+
 // UpdateExecFunc updates execution function
 func (e *Executor) UpdateExecFunc() transactional.ExecFunc {
 	return func(ctx context.Context, tx *pg.Tx) error {
 		q := orm.NewQueryContext(ctx, tx, e.entity).WherePK()
+		q, err := e.addQueryGeometryValue(ctx, tx, q, e.entity)
+		if err != nil {
+			return err
+		}
 		if _, err := q.Update(); err != nil {
 			return NewErrorFromCause(e.restQuery, err)
 		}
@@ -142,3 +285,100 @@ func (e *Executor) DeleteExecFunc() transactional.ExecFunc {
 		return nil
 	}
 }
+
+// checkExtension returns an error if PostgreSQL extension isn't installed in database
+func checkExtension(ctx context.Context, tx *pg.Tx, name string) error {
+	var installed bool
+	if _, err := tx.QueryOneContext(ctx, pg.Scan(&installed), "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = ?)", name); err != nil {
+		return &Error{Cause: err}
+	}
+	if !installed {
+		return NewErrorNotImplemented(fmt.Sprintf("extension '%v' is not installed in database (CREATE EXTENSION %v)", name, name))
+	}
+	return nil
+}
+
+// addQueryColumns adds selected columns, geometry field is selected with geometry expression
+func (e *Executor) addQueryColumns(q *orm.Query, sorts []*Sort, geometryExpr string) *orm.Query {
+	if e.resource == nil {
+		return addQueryColumns(q, nil, e.restQuery.Fields, sorts, "", "")
+	}
+	return addQueryColumns(q, orm.GetTable(e.resource.ResourceType()), e.restQuery.Fields, sorts, e.resource.GeometryField(), geometryExpr)
+}
+
+// geometryExpr gets expression selecting geometry field according to accept and crs, empty for raw geometry
+func (e *Executor) geometryExpr() string {
+	if e.resource == nil || e.resource.GeometryField() == "" {
+		return ""
+	}
+	if kmlRegexp.MatchString(e.restQuery.Accept) || gpxRegexp.MatchString(e.restQuery.Accept) {
+		// KML and GPX coordinates are always WGS 84
+		return fmt.Sprintf("ST_AsGeoJSON(ST_Transform(?, %d))", DefaultSRID)
+	}
+	expr := "?"
+	if e.restQuery.Crs != 0 {
+		expr = fmt.Sprintf("ST_Transform(?, %d)", e.restQuery.Crs)
+	}
+	if geoJSONRegexp.MatchString(e.restQuery.Accept) {
+		return "ST_AsGeoJSON(" + expr + ")"
+	}
+	if csvRegexp.MatchString(e.restQuery.Accept) || xlsxRegexp.MatchString(e.restQuery.Accept) {
+		return "ST_AsEWKT(" + expr + ")"
+	}
+	if expr != "?" {
+		return expr
+	}
+	return ""
+}
+
+// transformSpatialValues reprojects spatial filter and distance sort values into SRID of geometry field
+func (e *Executor) transformSpatialValues(ctx context.Context, tx *pg.Tx) error {
+	if e.resource == nil || e.resource.GeometryField() == "" {
+		return nil
+	}
+	srid, err := e.resource.nativeSRID(ctx, tx, e.restQuery.SearchPath)
+	if err != nil {
+		return NewErrorFromCause(e.restQuery, err)
+	}
+	if srid > 0 {
+		transformSpatialValues(e.restQuery.Filter, e.restQuery.Sorts, srid)
+	}
+	return nil
+}
+
+// addQueryGeometryValue sets written geometry value of entity reprojected into SRID of geometry field
+func (e *Executor) addQueryGeometryValue(ctx context.Context, tx *pg.Tx, q *orm.Query, entity interface{}) (*orm.Query, error) {
+	if e.resource == nil || e.resource.GeometryField() == "" {
+		return q, nil
+	}
+	field := findField(orm.GetTable(e.resource.ResourceType()), e.resource.GeometryField())
+	if field == nil {
+		return q, nil
+	}
+	text := strings.TrimSpace(geometryText(field.Value(reflect.ValueOf(entity).Elem())))
+	if text == "" {
+		return q, nil
+	}
+	srid, err := e.resource.nativeSRID(ctx, tx, e.restQuery.SearchPath)
+	if err != nil {
+		return nil, NewErrorFromCause(e.restQuery, err)
+	}
+	if hexRegexp.MatchString(text) {
+		// Hex encoded EWKB, as read from database
+		if srid > 0 {
+			q = q.Value(field.SQLName, "ST_Transform(?::geometry, ?)", text, srid)
+		}
+		return q, nil
+	}
+	geometry, err := parseGeometry(text, e.restQuery.inputSRID())
+	if err != nil {
+		return nil, &Error{Message: fmt.Sprintf("invalid value for attribute '%v'", field.SQLName), Code: 400, Cause: err}
+	}
+	geometry.transformSRID = srid
+	return q.Value(field.SQLName, "?", geometry), nil
+}
+
+// streamFetchSize is number of rows fetched from cursor at once
+const streamFetchSize = 1000
+
+var hexRegexp = regexp.MustCompile("^[0-9A-Fa-f]+$")
@@ -0,0 +1,6 @@
+package pgrest
+
+// CoerceSliceQuery exposes coercion of slice queries to tests
+func (e *Engine) CoerceSliceQuery(restQuery *RestQuery) error {
+	return e.coerceSliceQuery(restQuery, e.Config().GetResource(restQuery.Resource))
+}
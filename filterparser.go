@@ -0,0 +1,227 @@
+package pgrest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseFilter parses filter expression like "NbPages gt 100 and (Title ilk '%prince%' or AuthorID in (1,2))"
+func ParseFilter(str string) (*Filter, error) {
+	p := &filterParser{str: str}
+	p.next()
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected '%v'", p.tok.text)
+	}
+	return filter, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokLParen
+	tokRParen
+	tokComma
+	tokIllegal
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type filterParser struct {
+	str string
+	pos int
+	tok token
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return NewErrorBadRequest(fmt.Sprintf("filter syntax error at position %v: %v", p.tok.pos+1, fmt.Sprintf(format, args...)))
+}
+
+// next reads next token
+func (p *filterParser) next() {
+	for p.pos < len(p.str) && unicode.IsSpace(rune(p.str[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.str) {
+		p.tok = token{tokEOF, "end of filter", start}
+		return
+	}
+	c := p.str[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		p.tok = token{tokLParen, "(", start}
+	case c == ')':
+		p.pos++
+		p.tok = token{tokRParen, ")", start}
+	case c == ',':
+		p.pos++
+		p.tok = token{tokComma, ",", start}
+	case c == '\'' || c == '"':
+		var sb strings.Builder
+		p.pos++
+		for {
+			if p.pos >= len(p.str) {
+				p.tok = token{tokIllegal, "unterminated string", start}
+				return
+			}
+			if p.str[p.pos] == c {
+				if p.pos+1 < len(p.str) && p.str[p.pos+1] == c {
+					sb.WriteByte(c)
+					p.pos += 2
+					continue
+				}
+				p.pos++
+				break
+			}
+			sb.WriteByte(p.str[p.pos])
+			p.pos++
+		}
+		if c == '"' {
+			p.tok = token{tokIdent, sb.String(), start}
+		} else {
+			p.tok = token{tokString, sb.String(), start}
+		}
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		p.pos++
+		for p.pos < len(p.str) && strings.IndexByte("0123456789.eE+-", p.str[p.pos]) >= 0 {
+			p.pos++
+		}
+		p.tok = token{tokNumber, p.str[start:p.pos], start}
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.str) && (p.str[p.pos] == '_' || p.str[p.pos] == '.' || p.str[p.pos] >= 0x80 || unicode.IsLetter(rune(p.str[p.pos])) || unicode.IsDigit(rune(p.str[p.pos]))) {
+			p.pos++
+		}
+		p.tok = token{tokIdent, p.str[start:p.pos], start}
+	default:
+		p.pos++
+		p.tok = token{tokIllegal, string(c), start}
+	}
+}
+
+func (p *filterParser) isKeyword(keyword string) bool {
+	return p.tok.kind == tokIdent && strings.EqualFold(p.tok.text, keyword)
+}
+
+// parseOr parses: and-expression ('or' and-expression)*
+func (p *filterParser) parseOr() (*Filter, error) {
+	return p.parseGroup(Or, p.parseAnd)
+}
+
+// parseAnd parses: operand ('and' operand)*
+func (p *filterParser) parseAnd() (*Filter, error) {
+	return p.parseGroup(And, p.parseOperand)
+}
+
+func (p *filterParser) parseGroup(op Op, parseSub func() (*Filter, error)) (*Filter, error) {
+	filter, err := parseSub()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isKeyword(op.String()) {
+		return filter, nil
+	}
+	group := &Filter{Op: op, Filters: []*Filter{filter}}
+	for p.isKeyword(op.String()) {
+		p.next()
+		if filter, err = parseSub(); err != nil {
+			return nil, err
+		}
+		group.Filters = append(group.Filters, filter)
+	}
+	return group, nil
+}
+
+// parseOperand parses: '(' or-expression ')' | attribute operation [value]
+func (p *filterParser) parseOperand() (*Filter, error) {
+	if p.tok.kind == tokLParen {
+		p.next()
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("')' expected, got '%v'", p.tok.text)
+		}
+		p.next()
+		return filter, nil
+	}
+	if p.tok.kind != tokIdent {
+		return nil, p.errorf("attribute expected, got '%v'", p.tok.text)
+	}
+	filter := &Filter{Attr: p.tok.text}
+	p.next()
+	if p.tok.kind != tokIdent {
+		return nil, p.errorf("operation expected, got '%v'", p.tok.text)
+	}
+	filter.Op = Op(strings.ToLower(p.tok.text))
+	if !filter.Op.valid() || filter.Op == And || filter.Op == Or {
+		return nil, p.errorf("unknown operation '%v'", p.tok.text)
+	}
+	p.next()
+	if filter.Op == Null || filter.Op == Nnull {
+		return filter, nil
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	filter.Value = value
+	return filter, nil
+}
+
+// parseValue parses: string | number | true | false | null | '(' value (',' value)* ')'
+func (p *filterParser) parseValue() (interface{}, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokString:
+		p.next()
+		return tok.text, nil
+	case tok.kind == tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number '%v'", tok.text)
+		}
+		p.next()
+		return f, nil
+	case p.isKeyword("true"), p.isKeyword("false"):
+		p.next()
+		return strings.EqualFold(tok.text, "true"), nil
+	case p.isKeyword("null"):
+		p.next()
+		return nil, nil
+	case tok.kind == tokLParen:
+		values := make([]interface{}, 0)
+		p.next()
+		for p.tok.kind != tokRParen {
+			if len(values) > 0 {
+				if p.tok.kind != tokComma {
+					return nil, p.errorf("',' or ')' expected, got '%v'", p.tok.text)
+				}
+				p.next()
+			}
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		p.next()
+		return values, nil
+	}
+	return nil, p.errorf("value expected, got '%v'", tok.text)
+}
@@ -0,0 +1,70 @@
+package pgrest_test
+
+import (
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+var parseFilterTests = []struct {
+	str      string
+	expected *pgrest.Filter
+}{
+	{"NbPages gt 100", &pgrest.Filter{Op: pgrest.Gt, Attr: "NbPages", Value: 100.0}},
+	{"Title ilk '%prince%'", &pgrest.Filter{Op: pgrest.Ilk, Attr: "Title", Value: "%prince%"}},
+	{"Title eq 'Lettre à un otage'", &pgrest.Filter{Op: pgrest.Eq, Attr: "Title", Value: "Lettre à un otage"}},
+	{"Title eq 'L''Amérique'", &pgrest.Filter{Op: pgrest.Eq, Attr: "Title", Value: "L'Amérique"}},
+	{"AuthorID nnull", &pgrest.Filter{Op: pgrest.Nnull, Attr: "AuthorID"}},
+	{"AuthorID IN (1, 2)", &pgrest.Filter{Op: pgrest.In, Attr: "AuthorID", Value: []interface{}{1.0, 2.0}}},
+	{"NbPages gt 100 and (Title ilk '%prince%' or AuthorID in (1,2))", &pgrest.Filter{Op: pgrest.And, Filters: []*pgrest.Filter{
+		{Op: pgrest.Gt, Attr: "NbPages", Value: 100.0},
+		{Op: pgrest.Or, Filters: []*pgrest.Filter{
+			{Op: pgrest.Ilk, Attr: "Title", Value: "%prince%"},
+			{Op: pgrest.In, Attr: "AuthorID", Value: []interface{}{1.0, 2.0}},
+		}},
+	}}},
+	{"a eq true or b eq false and c eq null", &pgrest.Filter{Op: pgrest.Or, Filters: []*pgrest.Filter{
+		{Op: pgrest.Eq, Attr: "a", Value: true},
+		{Op: pgrest.And, Filters: []*pgrest.Filter{
+			{Op: pgrest.Eq, Attr: "b", Value: false},
+			{Op: pgrest.Eq, Attr: "c", Value: nil},
+		}},
+	}}},
+	{"a eq 1 and (b eq 2 and c eq 3)", &pgrest.Filter{Op: pgrest.And, Filters: []*pgrest.Filter{
+		{Op: pgrest.Eq, Attr: "a", Value: 1.0},
+		{Op: pgrest.And, Filters: []*pgrest.Filter{
+			{Op: pgrest.Eq, Attr: "b", Value: 2.0},
+			{Op: pgrest.Eq, Attr: "c", Value: 3.0},
+		}},
+	}}},
+	{"geom intersects 'SRID=2154;POINT(652000 6862000)'", &pgrest.Filter{Op: pgrest.Intersects, Attr: "geom", Value: "SRID=2154;POINT(652000 6862000)"}},
+	{"geom dwithin ('POINT(2.35 48.85)', 0.01)", &pgrest.Filter{Op: pgrest.Dwithin, Attr: "geom", Value: []interface{}{"POINT(2.35 48.85)", 0.01}}},
+}
+
+func TestParseFilter(t *testing.T) {
+	for _, pt := range parseFilterTests {
+		filter, err := pgrest.ParseFilter(pt.str)
+		assert.Nil(t, err)
+		assert.Equal(t, pt.expected, filter)
+		filter, err = pgrest.ParseFilter(filter.String())
+		assert.Nil(t, err)
+		assert.Equal(t, pt.expected, filter)
+	}
+	assert.Equal(t, "NbPages gt 100 and (Title ilk '%prince%' or AuthorID in (1, 2))", parseFilterTests[6].expected.String())
+	assert.Equal(t, "a eq 1 and (b eq 2 and c eq 3)", parseFilterTests[8].expected.String())
+
+	var err error
+	_, err = pgrest.ParseFilter("NbPages gt")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "position 11")
+	_, err = pgrest.ParseFilter("NbPages foo 100")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "position 9")
+	_, err = pgrest.ParseFilter("(NbPages gt 100")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "position 16")
+	_, err = pgrest.ParseFilter("Title eq 'abc")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "position 10")
+}
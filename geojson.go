@@ -0,0 +1,271 @@
+package pgrest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+var geoJSONRegexp = regexp.MustCompile("[+-/]geo\\+json($|[+-;])")
+
+// GeoJSONCodec structure, GeoJSON codec of resources with geometry field
+type GeoJSONCodec struct{}
+
+// MediaTypes implements Codec
+func (GeoJSONCodec) MediaTypes() []string {
+	return []string{"application/geo+json; charset=utf-8"}
+}
+
+// CanEncode implements EncodingChecker
+func (GeoJSONCodec) CanEncode(resource *Resource) bool {
+	return resource != nil && resource.GeometryField() != ""
+}
+
+// Encode implements Codec, page is encoded as feature collection
+func (GeoJSONCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	if resource == nil || resource.GeometryField() == "" {
+		return nil, NewErrorBadRequest(fmt.Sprintf("resource '%v' without geometry field", restQuery.Resource))
+	}
+	var geoJSON interface{}
+	var err error
+	if page, ok := entity.(*Page); ok {
+		if clusters, ok := page.Slice.(*[]ClusterItem); ok {
+			geoJSON = newClusterFeatureCollection(page, *clusters)
+		} else {
+			geoJSON, err = NewFeatureCollection(page, resource)
+		}
+	} else {
+		geoJSON, err = NewFeature(entity, resource)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(geoJSON)
+}
+
+// Decode implements Codec, content must be a feature
+func (GeoJSONCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	if resource == nil || resource.GeometryField() == "" {
+		return NewErrorBadRequest(fmt.Sprintf("resource '%v' without geometry field", restQuery.Resource))
+	}
+	if err := decodeFeature(content, resource, entity, restQuery.inputSRID()); err != nil {
+		return &Error{Message: "invalid GeoJSON feature", Code: 400, Cause: err}
+	}
+	return nil
+}
+
+// FeatureCollection structure, GeoJSON feature collection with page information as foreign members
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+	Offset   int        `json:"offset"`
+	Limit    int        `json:"limit"`
+	Count    int        `json:"count"`
+}
+
+// Feature structure, GeoJSON feature
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+	Links      []*Link                `json:"links,omitempty"`
+}
+
+// NewFeatureCollection constructs FeatureCollection from page, geometry field must contain GeoJSON
+func NewFeatureCollection(page *Page, resource *Resource) (*FeatureCollection, error) {
+	fc := &FeatureCollection{Type: "FeatureCollection", Features: make([]*Feature, 0), Offset: page.Offset, Limit: page.Limit, Count: page.Count}
+	slice := reflect.Indirect(reflect.ValueOf(page.Slice))
+	for i := 0; i < slice.Len(); i++ {
+		feature, err := NewFeature(slice.Index(i).Addr().Interface(), resource)
+		if err != nil {
+			return nil, err
+		}
+		fc.Features = append(fc.Features, feature)
+	}
+	return fc, nil
+}
+
+// NewFeature constructs Feature from entity, geometry field must contain GeoJSON
+func NewFeature(entity interface{}, resource *Resource) (*Feature, error) {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	f := &Feature{Type: "Feature", Geometry: json.RawMessage("null")}
+	if err = json.Unmarshal(data, &f.Properties); err != nil {
+		return nil, err
+	}
+	table := orm.GetTable(resource.ResourceType())
+	elem := reflect.Indirect(reflect.ValueOf(entity))
+	if len(table.PKs) == 1 {
+		f.ID = f.Properties[jsonName(table.PKs[0])]
+	}
+	if field := findField(table, resource.GeometryField()); field != nil {
+		delete(f.Properties, jsonName(field))
+		if geometry := geometryText(field.Value(elem)); strings.HasPrefix(geometry, "{") {
+			f.Geometry = json.RawMessage(geometry)
+		}
+	}
+	return f, nil
+}
+
+// geometryText gets geometry field value as text
+func geometryText(value reflect.Value) string {
+	value = reflect.Indirect(value)
+	switch {
+	case !value.IsValid():
+		return ""
+	case value.Kind() == reflect.String:
+		return value.String()
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+		return string(value.Bytes())
+	}
+	return ""
+}
+
+// jsonName gets json name of field
+func jsonName(field *orm.Field) string {
+	tag := strings.Split(field.Field.Tag.Get("json"), ",")[0]
+	if tag != "" && tag != "-" {
+		return tag
+	}
+	return field.GoName
+}
+
+// decodeFeature decodes GeoJSON feature into entity, geometry is set as EWKT (defaultSRID if feature has no crs)
+func decodeFeature(content []byte, resource *Resource, entity interface{}, defaultSRID int) error {
+	var feature Feature
+	if err := json.Unmarshal(content, &feature); err != nil {
+		return err
+	}
+	if feature.Type != "Feature" {
+		return fmt.Errorf("GeoJSON feature expected, got type '%v'", feature.Type)
+	}
+	if feature.Properties != nil {
+		data, err := json.Marshal(feature.Properties)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(data, entity); err != nil {
+			return err
+		}
+	}
+	table := orm.GetTable(resource.ResourceType())
+	field := findField(table, resource.GeometryField())
+	if field == nil || len(feature.Geometry) == 0 || string(feature.Geometry) == "null" {
+		return nil
+	}
+	geometry, err := parseGeometry(json.RawMessage(feature.Geometry), defaultSRID)
+	if err != nil {
+		return err
+	}
+	ewkt, err := geometry.EWKT()
+	if err != nil {
+		return err
+	}
+	value := field.Value(reflect.ValueOf(entity).Elem())
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		value = value.Elem()
+	}
+	switch {
+	case value.Kind() == reflect.String:
+		value.SetString(ewkt)
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+		value.SetBytes([]byte(ewkt))
+	default:
+		return fmt.Errorf("geometry field '%v' must be string or []byte", field.GoName)
+	}
+	return nil
+}
+
+// EWKT gets geometry as extended WKT ('SRID=4326;POINT(1 2)')
+func (g *Geometry) EWKT() (string, error) {
+	wkt := g.WKT
+	if g.GeoJSON != "" {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(g.GeoJSON), &m); err != nil {
+			return "", err
+		}
+		var err error
+		if wkt, err = geoJSONToWKT(m); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("SRID=%v;%v", g.SRID, wkt), nil
+}
+
+// geoJSONToWKT converts GeoJSON geometry to WKT
+func geoJSONToWKT(m map[string]interface{}) (string, error) {
+	typ, _ := m["type"].(string)
+	if typ == "GeometryCollection" {
+		geometries, ok := m["geometries"].([]interface{})
+		if !ok {
+			return "", errors.New("GeoJSON geometry collection without geometries")
+		}
+		wkts := make([]string, len(geometries))
+		for i, geometry := range geometries {
+			gm, ok := geometry.(map[string]interface{})
+			if !ok {
+				return "", errors.New("invalid GeoJSON geometry in collection")
+			}
+			wkt, err := geoJSONToWKT(gm)
+			if err != nil {
+				return "", err
+			}
+			wkts[i] = wkt
+		}
+		return "GEOMETRYCOLLECTION(" + strings.Join(wkts, ",") + ")", nil
+	}
+	depths := map[string]int{"Point": 0, "MultiPoint": 1, "LineString": 1, "MultiLineString": 2, "Polygon": 2, "MultiPolygon": 3}
+	depth, ok := depths[typ]
+	if !ok {
+		return "", fmt.Errorf("unknown GeoJSON geometry type '%v'", typ)
+	}
+	coordinates, err := wktCoordinates(m["coordinates"], depth)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(typ) + "(" + coordinates + ")", nil
+}
+
+// wktCoordinates converts GeoJSON coordinates with nesting depth to WKT coordinates
+func wktCoordinates(coordinates interface{}, depth int) (string, error) {
+	array, ok := coordinates.([]interface{})
+	if !ok {
+		return "", errors.New("invalid GeoJSON coordinates")
+	}
+	strs := make([]string, len(array))
+	for i, c := range array {
+		if depth == 0 {
+			f, ok := c.(float64)
+			if !ok {
+				return "", errors.New("invalid GeoJSON coordinate")
+			}
+			strs[i] = strconv.FormatFloat(f, 'f', -1, 64)
+			continue
+		}
+		str, err := wktCoordinates(c, depth-1)
+		if err != nil {
+			return "", err
+		}
+		if depth == 1 {
+			strs[i] = str
+		} else {
+			strs[i] = "(" + str + ")"
+		}
+	}
+	if depth == 0 {
+		return strings.Join(strs, " "), nil
+	}
+	return strings.Join(strs, ","), nil
+}
@@ -0,0 +1,58 @@
+package pgrest_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoJSON(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	resource := pgrest.NewResource("Place", (*Place)(nil), pgrest.All)
+	config.AddResource(resource)
+	engine := pgrest.NewEngine(config)
+	server := pgrest.NewServer(config)
+
+	var err error
+	var place *Place
+	var data []byte
+	var contentType string
+
+	assert.Equal(t, "geom", resource.GeometryField())
+
+	place = &Place{}
+	err = engine.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Place", ContentType: "application/geo+json", Content: []byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[2.2945,48.8584]},"properties":{"Name":"Eiffel"}}`)}, resource, place)
+	assert.Nil(t, err)
+	assert.Equal(t, "Eiffel", place.Name)
+	assert.Equal(t, "SRID=4326;POINT(2.2945 48.8584)", place.Geom)
+
+	place = &Place{}
+	err = engine.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Place", ContentType: "application/geo+json", Content: []byte(`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]},"properties":{"Name":"Triangle"}}`)}, resource, place)
+	assert.Nil(t, err)
+	assert.Equal(t, "SRID=4326;POLYGON((0 0,1 0,1 1,0 0))", place.Geom)
+
+	err = engine.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Place", ContentType: "application/geo+json", Content: []byte(`{"type":"FeatureCollection","features":[]}`)}, resource, place)
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+
+	page := &pgrest.Page{Slice: &[]Place{{ID: 1, Name: "Eiffel", Geom: `{"type":"Point","coordinates":[2.2945,48.8584]}`}, {ID: 2, Name: "Nowhere"}}, Offset: 0, Limit: 10, Count: 2}
+	data, contentType, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Accept: "application/geo+json"}, page)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/geo+json; charset=utf-8", contentType)
+	fc := &pgrest.FeatureCollection{}
+	err = json.Unmarshal(data, fc)
+	assert.Nil(t, err)
+	assert.Equal(t, "FeatureCollection", fc.Type)
+	assert.Equal(t, 2, fc.Count)
+	assert.Equal(t, 2, len(fc.Features))
+	assert.Equal(t, 1.0, fc.Features[0].ID)
+	assert.Equal(t, "Eiffel", fc.Features[0].Properties["Name"])
+	assert.Nil(t, fc.Features[0].Properties["Geom"])
+	assert.JSONEq(t, `{"type":"Point","coordinates":[2.2945,48.8584]}`, string(fc.Features[0].Geometry))
+	assert.Equal(t, "null", string(fc.Features[1].Geometry))
+
+	_, _, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Accept: "application/geo+json"}, page)
+	assert.NotNil(t, err)
+}
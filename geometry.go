@@ -0,0 +1,420 @@
+package pgrest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// DefaultSRID is spatial reference identifier of geometries without SRID (WGS 84, as GeoJSON)
+const DefaultSRID = 4326
+
+var ewktRegexp = regexp.MustCompile(`^(?i)SRID=(\d+);(.*)$`)
+var crsNameRegexp = regexp.MustCompile(`(?i)EPSG:+(\d+)$`)
+
+// Geometry structure, geometry value from GeoJSON or WKT
+type Geometry struct {
+	GeoJSON       string // GeoJSON geometry
+	WKT           string // WKT geometry, used if GeoJSON is empty
+	SRID          int    // spatial reference identifier
+	transformSRID int    // SRID geometry is reprojected into (0 for no reprojection)
+}
+
+// ParseGeometry parses GeoJSON geometry (object or string) or WKT with optional SRID ('SRID=2154;POINT(1 2)')
+func ParseGeometry(value interface{}) (*Geometry, error) {
+	return parseGeometry(value, DefaultSRID)
+}
+
+// parseGeometry parses geometry, defaultSRID is used for geometry without SRID
+func parseGeometry(value interface{}, defaultSRID int) (*Geometry, error) {
+	switch v := value.(type) {
+	case *Geometry:
+		return v, nil
+	case Geometry:
+		return &v, nil
+	case map[string]interface{}:
+		return parseGeoJSONGeometry(v, defaultSRID)
+	case json.RawMessage:
+		return parseGeometry(string(v), defaultSRID)
+	case string:
+		str := strings.TrimSpace(v)
+		if strings.HasPrefix(str, "{") {
+			var m map[string]interface{}
+			if err := json.Unmarshal([]byte(str), &m); err != nil {
+				return nil, err
+			}
+			return parseGeoJSONGeometry(m, defaultSRID)
+		}
+		g := &Geometry{WKT: str, SRID: defaultSRID}
+		if res := ewktRegexp.FindStringSubmatch(str); res != nil {
+			g.SRID, _ = strconv.Atoi(res[1])
+			g.WKT = strings.TrimSpace(res[2])
+		}
+		if g.WKT == "" {
+			return nil, errors.New("empty WKT geometry")
+		}
+		return g, nil
+	}
+	return nil, fmt.Errorf("GeoJSON or WKT geometry expected, got '%v'", value)
+}
+
+func parseGeoJSONGeometry(m map[string]interface{}, defaultSRID int) (*Geometry, error) {
+	if m["type"] == "Feature" {
+		geometry, ok := m["geometry"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("GeoJSON feature without geometry")
+		}
+		g, err := parseGeoJSONGeometry(geometry, defaultSRID)
+		if err == nil && m["crs"] != nil {
+			g.SRID = parseGeoJSONCrs(m["crs"], g.SRID)
+		}
+		return g, err
+	}
+	if _, ok := m["type"].(string); !ok {
+		return nil, errors.New("GeoJSON geometry without type")
+	}
+	g := &Geometry{SRID: parseGeoJSONCrs(m["crs"], defaultSRID)}
+	geometry := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != "crs" {
+			geometry[k] = v
+		}
+	}
+	data, err := json.Marshal(geometry)
+	if err != nil {
+		return nil, err
+	}
+	g.GeoJSON = string(data)
+	return g, nil
+}
+
+// parseGeoJSONCrs parses named crs member ({"type":"name","properties":{"name":"EPSG:2154"}})
+func parseGeoJSONCrs(crs interface{}, defaultSRID int) int {
+	if m, ok := crs.(map[string]interface{}); ok {
+		if properties, ok := m["properties"].(map[string]interface{}); ok {
+			if name, ok := properties["name"].(string); ok {
+				if res := crsNameRegexp.FindStringSubmatch(name); res != nil {
+					srid, _ := strconv.Atoi(res[1])
+					return srid
+				}
+			}
+		}
+	}
+	return defaultSRID
+}
+
+// AppendValue implements types.ValueAppender
+func (g *Geometry) AppendValue(b []byte, flags int) ([]byte, error) {
+	transform := g.transformSRID > 0 && g.transformSRID != g.SRID
+	if transform {
+		b = append(b, "ST_Transform("...)
+	}
+	if g.GeoJSON != "" {
+		b = append(b, "ST_SetSRID(ST_GeomFromGeoJSON("...)
+		b = types.AppendString(b, g.GeoJSON, flags)
+		b = append(b, "), "...)
+	} else {
+		b = append(b, "ST_GeomFromText("...)
+		b = types.AppendString(b, g.WKT, flags)
+		b = append(b, ", "...)
+	}
+	b = strconv.AppendInt(b, int64(g.SRID), 10)
+	b = append(b, ')')
+	if transform {
+		b = appendTransformSRID(b, g.transformSRID)
+	}
+	return b, nil
+}
+
+func (g *Geometry) String() string {
+	if g.GeoJSON != "" && g.SRID != DefaultSRID {
+		return fmt.Sprintf(`{"crs":{"type":"name","properties":{"name":"EPSG:%v"}},%v`, g.SRID, strings.TrimPrefix(g.GeoJSON, "{"))
+	} else if g.GeoJSON != "" {
+		return g.GeoJSON
+	}
+	return fmt.Sprintf("SRID=%v;%v", g.SRID, g.WKT)
+}
+
+// Envelope structure, bounding box
+type Envelope struct {
+	MinX          float64
+	MinY          float64
+	MaxX          float64
+	MaxY          float64
+	SRID          int
+	transformSRID int // SRID envelope is reprojected into (0 for no reprojection)
+}
+
+// ParseEnvelope parses bounding box from [minx, miny, maxx, maxy(, srid)] array or "minx,miny,maxx,maxy(,srid)" string
+func ParseEnvelope(value interface{}) (*Envelope, error) {
+	return parseEnvelope(value, DefaultSRID)
+}
+
+// parseEnvelope parses bounding box, defaultSRID is used for bounding box without SRID
+func parseEnvelope(value interface{}, defaultSRID int) (*Envelope, error) {
+	var values []interface{}
+	switch v := value.(type) {
+	case *Envelope:
+		return v, nil
+	case Envelope:
+		return &v, nil
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			values = append(values, strings.TrimSpace(s))
+		}
+	default:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, fmt.Errorf("bounding box 'minx,miny,maxx,maxy[,srid]' expected, got '%v'", value)
+		}
+		for i := 0; i < rv.Len(); i++ {
+			values = append(values, rv.Index(i).Interface())
+		}
+	}
+	if len(values) != 4 && len(values) != 5 {
+		return nil, fmt.Errorf("bounding box 'minx,miny,maxx,maxy[,srid]' expected, got '%v'", value)
+	}
+	coords := make([]float64, len(values))
+	for i, v := range values {
+		f, err := coerceFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		coords[i] = f
+	}
+	e := &Envelope{MinX: coords[0], MinY: coords[1], MaxX: coords[2], MaxY: coords[3], SRID: defaultSRID}
+	if len(coords) == 5 {
+		e.SRID = int(coords[4])
+	}
+	if e.MinX > e.MaxX || e.MinY > e.MaxY {
+		return nil, errors.New("bounding box minimum greater than maximum")
+	}
+	return e, nil
+}
+
+// AppendValue implements types.ValueAppender
+func (e *Envelope) AppendValue(b []byte, flags int) ([]byte, error) {
+	transform := e.transformSRID > 0 && e.transformSRID != e.SRID
+	if transform {
+		b = append(b, "ST_Transform("...)
+	}
+	b = append(b, "ST_MakeEnvelope("...)
+	for _, f := range []float64{e.MinX, e.MinY, e.MaxX, e.MaxY} {
+		b = strconv.AppendFloat(b, f, 'f', -1, 64)
+		b = append(b, ", "...)
+	}
+	b = strconv.AppendInt(b, int64(e.SRID), 10)
+	b = append(b, ')')
+	if transform {
+		b = appendTransformSRID(b, e.transformSRID)
+	}
+	return b, nil
+}
+
+// appendTransformSRID closes ST_Transform call with target SRID
+func appendTransformSRID(b []byte, srid int) []byte {
+	b = append(b, ", "...)
+	b = strconv.AppendInt(b, int64(srid), 10)
+	return append(b, ')')
+}
+
+// GeometryDistance structure, geometry and distance for 'dwithin' operation
+type GeometryDistance struct {
+	Geometry *Geometry
+	Distance float64
+}
+
+// ParseGeometryDistance parses [geometry, distance] array or {"geometry": geometry, "distance": distance} object
+func ParseGeometryDistance(value interface{}) (*GeometryDistance, error) {
+	return parseGeometryDistance(value, DefaultSRID)
+}
+
+// parseGeometryDistance parses geometry and distance, defaultSRID is used for geometry without SRID
+func parseGeometryDistance(value interface{}, defaultSRID int) (*GeometryDistance, error) {
+	var geometry, distance interface{}
+	switch v := value.(type) {
+	case *GeometryDistance:
+		return v, nil
+	case GeometryDistance:
+		return &v, nil
+	case map[string]interface{}:
+		geometry, distance = v["geometry"], v["distance"]
+	default:
+		rv := reflect.ValueOf(value)
+		if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Len() != 2 {
+			return nil, fmt.Errorf("geometry and distance expected, got '%v'", value)
+		}
+		geometry, distance = rv.Index(0).Interface(), rv.Index(1).Interface()
+	}
+	g, err := parseGeometry(geometry, defaultSRID)
+	if err != nil {
+		return nil, err
+	}
+	d, err := coerceFloat(distance)
+	if err != nil {
+		return nil, err
+	}
+	if d < 0 {
+		return nil, errors.New("distance must not be negative")
+	}
+	return &GeometryDistance{Geometry: g, Distance: d}, nil
+}
+
+// coerceSpatialFilter converts spatial filter value into Geometry, Envelope or GeometryDistance,
+// defaultSRID is used for values without SRID
+func coerceSpatialFilter(filter *Filter, defaultSRID int) error {
+	var err error
+	switch filter.Op {
+	case Intersects, Within, Contains:
+		filter.Value, err = parseGeometry(filter.Value, defaultSRID)
+	case Dwithin:
+		filter.Value, err = parseGeometryDistance(filter.Value, defaultSRID)
+	case Bbox:
+		filter.Value, err = parseEnvelope(filter.Value, defaultSRID)
+	}
+	if err != nil {
+		return &Error{Message: fmt.Sprintf("invalid value for attribute '%v'", filter.Attr), Code: 400, Cause: err}
+	}
+	return nil
+}
+
+// coerceDistanceSorts checks geometry attributes of distance sorts and converts sort values into Geometry,
+// defaultSRID is used for values without SRID
+func coerceDistanceSorts(table *orm.Table, sorts []*Sort, defaultSRID int) error {
+	for _, sort := range sorts {
+		if sort.Func != Distance {
+			continue
+		}
+		field := findField(table, sort.Name)
+		if field == nil || !isGeometryField(field) {
+			return NewErrorParam("sort", fmt.Errorf("'%v' isn't a geometry attribute", sort.Name))
+		}
+		sort.Name = field.SQLName
+		geometry, err := parseGeometry(sort.Value, defaultSRID)
+		if err != nil {
+			return NewErrorParam("sort", err)
+		}
+		sort.Value = geometry
+	}
+	return nil
+}
+
+// isGeometryField checks that field sql type is geometry or geography
+func isGeometryField(field *orm.Field) bool {
+	sqlType := strings.ToLower(field.SQLType)
+	return strings.HasPrefix(sqlType, "geometry") || strings.HasPrefix(sqlType, "geography")
+}
+
+func isSpatialOp(op Op) bool {
+	switch op {
+	case Intersects, Within, Contains, Dwithin, Bbox:
+		return true
+	}
+	return false
+}
+
+// transformSpatialValues sets SRID spatial filter and distance sort values are reprojected into
+func transformSpatialValues(filter *Filter, sorts []*Sort, srid int) {
+	if filter != nil {
+		switch v := filter.Value.(type) {
+		case *Geometry:
+			v.transformSRID = srid
+		case *GeometryDistance:
+			v.Geometry.transformSRID = srid
+		case *Envelope:
+			v.transformSRID = srid
+		}
+		for _, subfilter := range filter.Filters {
+			transformSpatialValues(subfilter, nil, srid)
+		}
+	}
+	for _, sort := range sorts {
+		if geometry, ok := sort.Value.(*Geometry); ok && sort.Func == Distance {
+			geometry.transformSRID = srid
+		}
+	}
+}
+
+var crsRegexp = regexp.MustCompile(`(?i)^(?:EPSG:+|urn:ogc:def:crs:EPSG:[^:]*:|https?://www\.opengis\.net/def/crs/EPSG/[^/]*/)?(\d+)$`)
+var crs84Regexp = regexp.MustCompile(`(?i)^(?:urn:ogc:def:crs:OGC:[^:]*:|https?://www\.opengis\.net/def/crs/OGC/[^/]*/)?CRS84$`)
+
+// ParseCrs parses coordinate reference system ('3857', 'EPSG:3857', 'http://www.opengis.net/def/crs/EPSG/0/3857', 'CRS84', ...) into SRID
+func ParseCrs(crs string) (int, error) {
+	crs = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(crs), "<"), ">")
+	if crs84Regexp.MatchString(crs) {
+		return DefaultSRID, nil
+	}
+	if res := crsRegexp.FindStringSubmatch(crs); res != nil {
+		if srid, err := strconv.Atoi(res[1]); err == nil && srid > 0 {
+			return srid, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown coordinate reference system '%v'", crs)
+}
+
+// CrsURI gets coordinate reference system URI of SRID
+func CrsURI(srid int) string {
+	return fmt.Sprintf("http://www.opengis.net/def/crs/EPSG/0/%v", srid)
+}
+
+// nativeSRID gets SRID of resource geometry field, looked up from geometry_columns if not set and cached by search path (0 if unknown)
+func (r *Resource) nativeSRID(ctx context.Context, tx *pg.Tx, searchPath string) (int, error) {
+	r.sridMutex.Lock()
+	srid, ok := r.srids[searchPath]
+	if r.srid != 0 {
+		srid, ok = r.srid, true
+	}
+	r.sridMutex.Unlock()
+	if ok {
+		return srid, nil
+	}
+	srid, err := geometrySRID(ctx, tx, orm.GetTable(r.resourceType), r.GeometryField())
+	if err != nil || srid == 0 {
+		// Misses aren't cached, geometry column may be registered later
+		return 0, err
+	}
+	r.sridMutex.Lock()
+	defer r.sridMutex.Unlock()
+	if r.srids == nil {
+		r.srids = make(map[string]int)
+	}
+	r.srids[searchPath] = srid
+	return srid, nil
+}
+
+// geometrySRID gets native SRID of geometry column from geometry_columns (0 if unknown)
+func geometrySRID(ctx context.Context, tx *pg.Tx, table *orm.Table, geometryField string) (int, error) {
+	schema, name := tableSchemaAndName(table)
+	var srids []int
+	var err error
+	if schema != "" {
+		_, err = tx.QueryContext(ctx, &srids, "SELECT srid FROM geometry_columns WHERE f_table_schema = ? AND f_table_name = ? AND f_geometry_column = ?", schema, name, geometryField)
+	} else {
+		_, err = tx.QueryContext(ctx, &srids, "SELECT srid FROM geometry_columns WHERE f_table_schema = ANY (current_schemas(true)) AND f_table_name = ? AND f_geometry_column = ? ORDER BY array_position(current_schemas(true), f_table_schema::name)", name, geometryField)
+	}
+	if err != nil || len(srids) == 0 {
+		return 0, err
+	}
+	return srids[0], nil
+}
+
+// tableSchemaAndName gets unquoted schema (empty if not specified) and name of table
+func tableSchemaAndName(table *orm.Table) (string, string) {
+	parts := strings.Split(string(table.SQLName), ".")
+	for i, part := range parts {
+		parts[i] = strings.Replace(strings.Trim(part, "\""), "\"\"", "\"", -1)
+	}
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return "", parts[len(parts)-1]
+}
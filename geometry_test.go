@@ -0,0 +1,81 @@
+package pgrest_test
+
+import (
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/go-pg/pg/v10/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeometry(t *testing.T) {
+	var err error
+	var geometry *pgrest.Geometry
+	var envelope *pgrest.Envelope
+	var geometryDistance *pgrest.GeometryDistance
+	var data []byte
+
+	geometry, err = pgrest.ParseGeometry(map[string]interface{}{"type": "Point", "coordinates": []interface{}{2.35, 48.85}})
+	assert.Nil(t, err)
+	assert.Equal(t, 4326, geometry.SRID)
+	data, err = geometry.AppendValue(nil, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, `ST_SetSRID(ST_GeomFromGeoJSON('{"coordinates":[2.35,48.85],"type":"Point"}'), 4326)`, string(data))
+
+	geometry, err = pgrest.ParseGeometry(`{"type":"Point","coordinates":[652000,6862000],"crs":{"type":"name","properties":{"name":"urn:ogc:def:crs:EPSG::2154"}}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, 2154, geometry.SRID)
+
+	geometry, err = pgrest.ParseGeometry("SRID=2154;POINT(652000 6862000)")
+	assert.Nil(t, err)
+	data, err = geometry.AppendValue(nil, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "ST_GeomFromText('POINT(652000 6862000)', 2154)", string(data))
+
+	geometry, err = pgrest.ParseGeometry("POINT(2.35 48.85)")
+	assert.Nil(t, err)
+	assert.Equal(t, 4326, geometry.SRID)
+
+	_, err = pgrest.ParseGeometry(12)
+	assert.NotNil(t, err)
+	_, err = pgrest.ParseGeometry(map[string]interface{}{"coordinates": []interface{}{2.35, 48.85}})
+	assert.NotNil(t, err)
+
+	envelope, err = pgrest.ParseEnvelope("2.2,48.8,2.5,48.9")
+	assert.Nil(t, err)
+	data, err = envelope.AppendValue(nil, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "ST_MakeEnvelope(2.2, 48.8, 2.5, 48.9, 4326)", string(data))
+	_, err = pgrest.ParseEnvelope([]interface{}{2.5, 48.8, 2.2, 48.9})
+	assert.NotNil(t, err)
+
+	geometryDistance, err = pgrest.ParseGeometryDistance([]interface{}{"POINT(2.35 48.85)", 100.0})
+	assert.Nil(t, err)
+	assert.Equal(t, 100.0, geometryDistance.Distance)
+	_, err = pgrest.ParseGeometryDistance(map[string]interface{}{"geometry": "POINT(2.35 48.85)", "distance": -1.0})
+	assert.NotNil(t, err)
+
+	var _ types.ValueAppender = geometry
+}
+
+func TestParseCrs(t *testing.T) {
+	for crs, expected := range map[string]int{
+		"3857":                       3857,
+		"EPSG:2154":                  2154,
+		"epsg:4326":                  4326,
+		"urn:ogc:def:crs:EPSG::3857": 3857,
+		"http://www.opengis.net/def/crs/EPSG/0/2154":   2154,
+		"<http://www.opengis.net/def/crs/EPSG/0/3857>": 3857,
+		"http://www.opengis.net/def/crs/OGC/1.3/CRS84": 4326,
+		"CRS84": 4326,
+	} {
+		srid, err := pgrest.ParseCrs(crs)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, srid, crs)
+	}
+	for _, crs := range []string{"", "EPSG:", "EPSG:abc", "0", "WGS84"} {
+		_, err := pgrest.ParseCrs(crs)
+		assert.NotNil(t, err, crs)
+	}
+	assert.Equal(t, "http://www.opengis.net/def/crs/EPSG/0/2154", pgrest.CrsURI(2154))
+}
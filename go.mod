@@ -4,7 +4,7 @@ go 1.12
 
 require (
 	github.com/go-pg/pg/v10 v10.10.6
-	github.com/google/uuid v1.3.0 // indirect
-	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/google/uuid v1.3.0
+	github.com/stretchr/testify v1.7.0
 	github.com/vmihailenco/msgpack/v5 v5.3.4
 )
@@ -0,0 +1,159 @@
+package pgrest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var gpxRegexp = regexp.MustCompile("[+-/]gpx\\+xml($|[+-;])")
+
+// GPXCodec structure, GPX encoder of resources with geometry field
+type GPXCodec struct{}
+
+// MediaTypes implements Codec
+func (GPXCodec) MediaTypes() []string {
+	return []string{"application/gpx+xml; charset=utf-8"}
+}
+
+// CanEncode implements EncodingChecker
+func (GPXCodec) CanEncode(resource *Resource) bool {
+	return resource != nil && resource.GeometryField() != ""
+}
+
+// Encode implements Codec
+func (GPXCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	if resource == nil || resource.GeometryField() == "" {
+		return nil, NewErrorBadRequest(fmt.Sprintf("resource '%v' without geometry field", restQuery.Resource))
+	}
+	return encodeGPX(entity, resource)
+}
+
+// Decode implements Codec
+func (GPXCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	return ErrUnsupported
+}
+
+// encodeGPX encodes page or entity as GPX document, points are waypoints and other geometries are tracks
+func encodeGPX(entity interface{}, resource *Resource) ([]byte, error) {
+	features, err := newExportFeatures(entity, resource)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := newXMLWriter(&buf)
+	w.start("gpx", "xmlns", "http://www.topografix.com/GPX/1/1", "version", "1.1", "creator", "pgrest")
+	// Waypoints must precede tracks
+	for _, feature := range features {
+		for _, position := range gpxPoints(feature.Geometry) {
+			if err = writeGPXPoint(w, "wpt", position, feature); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, feature := range features {
+		segments := gpxSegments(feature.Geometry)
+		if len(segments) == 0 {
+			continue
+		}
+		w.start("trk")
+		writeGPXDescription(w, feature)
+		for _, segment := range segments {
+			w.start("trkseg")
+			for _, position := range segment {
+				if err = writeGPXPoint(w, "trkpt", position, nil); err != nil {
+					return nil, err
+				}
+			}
+			w.end("trkseg")
+		}
+		w.end("trk")
+	}
+	w.end("gpx")
+	if err = w.flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeGPXPoint(w *xmlWriter, name string, position interface{}, feature *exportFeature) error {
+	coords, _ := position.([]interface{})
+	if len(coords) < 2 {
+		return fmt.Errorf("invalid GeoJSON position '%v'", position)
+	}
+	lon, ok1 := coords[0].(float64)
+	lat, ok2 := coords[1].(float64)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("invalid GeoJSON position '%v'", position)
+	}
+	w.start(name, "lat", strconv.FormatFloat(lat, 'f', -1, 64), "lon", strconv.FormatFloat(lon, 'f', -1, 64))
+	if len(coords) > 2 {
+		if ele, ok := coords[2].(float64); ok {
+			w.text("ele", strconv.FormatFloat(ele, 'f', -1, 64))
+		}
+	}
+	if feature != nil {
+		writeGPXDescription(w, feature)
+	}
+	w.end(name)
+	return w.err
+}
+
+func writeGPXDescription(w *xmlWriter, feature *exportFeature) {
+	if feature.Name != "" {
+		w.text("name", feature.Name)
+	}
+	if feature.Description != "" {
+		w.text("desc", feature.Description)
+	}
+}
+
+// gpxPoints gets positions of GeoJSON points
+func gpxPoints(geometry map[string]interface{}) []interface{} {
+	switch geometry["type"] {
+	case "Point":
+		return []interface{}{geometry["coordinates"]}
+	case "MultiPoint":
+		positions, _ := geometry["coordinates"].([]interface{})
+		return positions
+	case "GeometryCollection":
+		var positions []interface{}
+		geometries, _ := geometry["geometries"].([]interface{})
+		for _, g := range geometries {
+			if m, ok := g.(map[string]interface{}); ok {
+				positions = append(positions, gpxPoints(m)...)
+			}
+		}
+		return positions
+	}
+	return nil
+}
+
+// gpxSegments gets track segments of GeoJSON lines and polygon rings
+func gpxSegments(geometry map[string]interface{}) [][]interface{} {
+	var segments [][]interface{}
+	coordinates, _ := geometry["coordinates"].([]interface{})
+	switch geometry["type"] {
+	case "LineString":
+		segments = append(segments, coordinates)
+	case "MultiLineString", "Polygon":
+		for _, line := range coordinates {
+			if positions, ok := line.([]interface{}); ok {
+				segments = append(segments, positions)
+			}
+		}
+	case "MultiPolygon":
+		for _, polygon := range coordinates {
+			segments = append(segments, gpxSegments(map[string]interface{}{"type": "Polygon", "coordinates": polygon})...)
+		}
+	case "GeometryCollection":
+		geometries, _ := geometry["geometries"].([]interface{})
+		for _, g := range geometries {
+			if m, ok := g.(map[string]interface{}); ok {
+				segments = append(segments, gpxSegments(m)...)
+			}
+		}
+	}
+	return segments
+}
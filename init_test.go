@@ -39,6 +39,7 @@ type Author struct {
 	Picture        []byte  `pg:",type:bytea"`
 	Books          []*Book `pg:"rel:has-many"`
 	TransientField string  `pg:"-"`
+	Score          float64 `pg:"-"`
 }
 
 func (b *Author) AfterSelect(ctx context.Context) error {
@@ -49,6 +50,13 @@ func (b *Author) AfterSelect(ctx context.Context) error {
 	return nil
 }
 
+type Place struct {
+	ID       int
+	Name     string
+	Geom     string  `pg:"type:geometry(Point,4326)"`
+	Distance float64 `pg:"-"`
+}
+
 type PageOnly struct {
 	NbPages int
 }
@@ -68,6 +76,7 @@ func initTests(t *testing.T) (*pg.DB, *pgrest.Config) {
 	config.AddResource(pgrest.NewResource("Todo", (*Todo)(nil), pgrest.All))
 	config.AddResource(pgrest.NewResource("Author", (*Author)(nil), pgrest.All))
 	config.AddResource(pgrest.NewResource("Book", (*Book)(nil), pgrest.All))
+	config.AddResource(pgrest.NewResource("Place", (*Place)(nil), pgrest.All))
 	return db, config
 }
 
@@ -0,0 +1,290 @@
+package pgrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+var kmlRegexp = regexp.MustCompile("[+-/]vnd\\.google-earth\\.kml\\+xml($|[+-;])")
+
+// KMLCodec structure, KML encoder of resources with geometry field
+type KMLCodec struct{}
+
+// MediaTypes implements Codec
+func (KMLCodec) MediaTypes() []string {
+	return []string{"application/vnd.google-earth.kml+xml; charset=utf-8"}
+}
+
+// CanEncode implements EncodingChecker
+func (KMLCodec) CanEncode(resource *Resource) bool {
+	return resource != nil && resource.GeometryField() != ""
+}
+
+// Encode implements Codec
+func (KMLCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	if resource == nil || resource.GeometryField() == "" {
+		return nil, NewErrorBadRequest(fmt.Sprintf("resource '%v' without geometry field", restQuery.Resource))
+	}
+	return encodeKML(entity, resource)
+}
+
+// Decode implements Codec
+func (KMLCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	return ErrUnsupported
+}
+
+// exportFeature structure, feature exported with name and description
+type exportFeature struct {
+	Name        string
+	Description string
+	Geometry    map[string]interface{}
+	Properties  map[string]interface{}
+}
+
+// newExportFeatures constructs exported features from page or entity, geometry field must contain GeoJSON
+func newExportFeatures(entity interface{}, resource *Resource) ([]*exportFeature, error) {
+	var features []*Feature
+	if page, ok := entity.(*Page); ok {
+		if clusters, ok := page.Slice.(*[]ClusterItem); ok {
+			features = newClusterFeatureCollection(page, *clusters).Features
+		} else {
+			fc, err := NewFeatureCollection(page, resource)
+			if err != nil {
+				return nil, err
+			}
+			features = fc.Features
+		}
+	} else {
+		feature, err := NewFeature(entity, resource)
+		if err != nil {
+			return nil, err
+		}
+		features = []*Feature{feature}
+	}
+	table := orm.GetTable(resource.ResourceType())
+	nameKey := exportFieldKey(table, resource.NameField())
+	descriptionKey := exportFieldKey(table, resource.DescriptionField())
+	exportFeatures := make([]*exportFeature, len(features))
+	for i, feature := range features {
+		f := &exportFeature{Properties: make(map[string]interface{})}
+		if string(feature.Geometry) != "null" {
+			if err := json.Unmarshal(feature.Geometry, &f.Geometry); err != nil {
+				return nil, err
+			}
+		}
+		for k, v := range feature.Properties {
+			switch {
+			case k == nameKey && v != nil:
+				f.Name = fmt.Sprint(v)
+			case k == descriptionKey && v != nil:
+				f.Description = fmt.Sprint(v)
+			default:
+				f.Properties[k] = v
+			}
+		}
+		if f.Name == "" && feature.ID != nil {
+			f.Name = fmt.Sprint(feature.ID)
+		}
+		exportFeatures[i] = f
+	}
+	return exportFeatures, nil
+}
+
+// exportFieldKey gets properties key of field
+func exportFieldKey(table *orm.Table, name string) string {
+	if field := findField(table, name); field != nil {
+		return jsonName(field)
+	}
+	return name
+}
+
+// xmlWriter writes XML elements, first error is kept
+type xmlWriter struct {
+	encoder *xml.Encoder
+	err     error
+}
+
+func newXMLWriter(buf *bytes.Buffer) *xmlWriter {
+	buf.WriteString(xml.Header)
+	return &xmlWriter{encoder: xml.NewEncoder(buf)}
+}
+
+func (w *xmlWriter) start(name string, attrs ...string) {
+	if w.err != nil {
+		return
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+	}
+	w.err = w.encoder.EncodeToken(start)
+}
+
+func (w *xmlWriter) end(name string) {
+	if w.err != nil {
+		return
+	}
+	w.err = w.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+}
+
+func (w *xmlWriter) text(name string, text string, attrs ...string) {
+	w.start(name, attrs...)
+	if w.err == nil {
+		w.err = w.encoder.EncodeToken(xml.CharData(text))
+	}
+	w.end(name)
+}
+
+func (w *xmlWriter) flush() error {
+	if w.err == nil {
+		w.err = w.encoder.Flush()
+	}
+	return w.err
+}
+
+// encodeKML encodes page or entity as KML document
+func encodeKML(entity interface{}, resource *Resource) ([]byte, error) {
+	features, err := newExportFeatures(entity, resource)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := newXMLWriter(&buf)
+	w.start("kml", "xmlns", "http://www.opengis.net/kml/2.2")
+	w.start("Document")
+	w.text("name", resource.Name())
+	for _, feature := range features {
+		w.start("Placemark")
+		if feature.Name != "" {
+			w.text("name", feature.Name)
+		}
+		if feature.Description != "" {
+			w.text("description", feature.Description)
+		}
+		if len(feature.Properties) > 0 {
+			w.start("ExtendedData")
+			for _, k := range sortedKeys(feature.Properties) {
+				if v := feature.Properties[k]; v != nil {
+					w.start("Data", "name", k)
+					w.text("value", exportValue(v))
+					w.end("Data")
+				}
+			}
+			w.end("ExtendedData")
+		}
+		if feature.Geometry != nil {
+			if err = writeKMLGeometry(w, feature.Geometry); err != nil {
+				return nil, err
+			}
+		}
+		w.end("Placemark")
+	}
+	w.end("Document")
+	w.end("kml")
+	if err = w.flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeKMLGeometry writes GeoJSON geometry as KML geometry
+func writeKMLGeometry(w *xmlWriter, geometry map[string]interface{}) error {
+	typ, _ := geometry["type"].(string)
+	coordinates := geometry["coordinates"]
+	switch typ {
+	case "Point":
+		w.start("Point")
+		w.text("coordinates", kmlCoordinates([]interface{}{coordinates}))
+		w.end("Point")
+	case "LineString":
+		w.start("LineString")
+		w.text("coordinates", kmlCoordinates(coordinates))
+		w.end("LineString")
+	case "Polygon":
+		rings, _ := coordinates.([]interface{})
+		w.start("Polygon")
+		for i, ring := range rings {
+			boundary := "innerBoundaryIs"
+			if i == 0 {
+				boundary = "outerBoundaryIs"
+			}
+			w.start(boundary)
+			w.start("LinearRing")
+			w.text("coordinates", kmlCoordinates(ring))
+			w.end("LinearRing")
+			w.end(boundary)
+		}
+		w.end("Polygon")
+	case "MultiPoint", "MultiLineString", "MultiPolygon":
+		parts, _ := coordinates.([]interface{})
+		w.start("MultiGeometry")
+		for _, part := range parts {
+			if err := writeKMLGeometry(w, map[string]interface{}{"type": strings.TrimPrefix(typ, "Multi"), "coordinates": part}); err != nil {
+				return err
+			}
+		}
+		w.end("MultiGeometry")
+	case "GeometryCollection":
+		geometries, _ := geometry["geometries"].([]interface{})
+		w.start("MultiGeometry")
+		for _, g := range geometries {
+			if m, ok := g.(map[string]interface{}); ok {
+				if err := writeKMLGeometry(w, m); err != nil {
+					return err
+				}
+			}
+		}
+		w.end("MultiGeometry")
+	default:
+		return fmt.Errorf("unknown GeoJSON geometry type '%v'", typ)
+	}
+	return w.err
+}
+
+// kmlCoordinates formats GeoJSON positions as KML coordinates ('x,y[,z] x,y[,z]')
+func kmlCoordinates(positions interface{}) string {
+	array, _ := positions.([]interface{})
+	strs := make([]string, 0, len(array))
+	for _, position := range array {
+		coords, _ := position.([]interface{})
+		values := make([]string, 0, len(coords))
+		for _, c := range coords {
+			if f, ok := c.(float64); ok {
+				values = append(values, strconv.FormatFloat(f, 'f', -1, 64))
+			}
+		}
+		strs = append(strs, strings.Join(values, ","))
+	}
+	return strings.Join(strs, " ")
+}
+
+// exportValue formats property value as text, objects and arrays as JSON
+func exportValue(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err == nil {
+			return string(data)
+		}
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,51 @@
+package pgrest_test
+
+import (
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKMLAndGPX(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	resource := pgrest.NewResource("Place", (*Place)(nil), pgrest.All)
+	resource.SetNameField("Name")
+	config.AddResource(resource)
+	server := pgrest.NewServer(config)
+
+	var err error
+	var data []byte
+	var contentType string
+
+	places := []Place{
+		{ID: 1, Name: "Eiffel", Geom: `{"type":"Point","coordinates":[2.2945,48.8584]}`},
+		{ID: 2, Name: "Seine & Co", Geom: `{"type":"LineString","coordinates":[[2.29,48.86],[2.35,48.85,35]]}`},
+	}
+	page := &pgrest.Page{Slice: &places, Offset: 0, Limit: 10, Count: 2}
+
+	data, contentType, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Accept: "application/vnd.google-earth.kml+xml"}, page)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/vnd.google-earth.kml+xml; charset=utf-8", contentType)
+	assert.Contains(t, string(data), `<kml xmlns="http://www.opengis.net/kml/2.2"><Document><name>Place</name>`)
+	assert.Contains(t, string(data), `<Placemark><name>Eiffel</name><ExtendedData><Data name="Distance"><value>0</value></Data><Data name="ID"><value>1</value></Data></ExtendedData><Point><coordinates>2.2945,48.8584</coordinates></Point></Placemark>`)
+	assert.Contains(t, string(data), `<name>Seine &amp; Co</name>`)
+	assert.Contains(t, string(data), `<LineString><coordinates>2.29,48.86 2.35,48.85,35</coordinates></LineString>`)
+
+	data, contentType, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Accept: "application/gpx+xml"}, page)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/gpx+xml; charset=utf-8", contentType)
+	assert.Contains(t, string(data), `<wpt lat="48.8584" lon="2.2945"><name>Eiffel</name></wpt><trk><name>Seine &amp; Co</name><trkseg><trkpt lat="48.86" lon="2.29"></trkpt><trkpt lat="48.85" lon="2.35"><ele>35</ele></trkpt></trkseg></trk></gpx>`)
+
+	_, _, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Accept: "application/gpx+xml"}, &places[0])
+	assert.Nil(t, err)
+
+	clusters := []pgrest.ClusterItem{{Geometry: `{"type":"Point","coordinates":[2.3,48.86]}`, Count: 2}}
+	data, _, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Accept: "application/vnd.google-earth.kml+xml"}, &pgrest.Page{Slice: &clusters, Limit: 10, Count: 1})
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `<Placemark><ExtendedData><Data name="count"><value>2</value></Data></ExtendedData><Point><coordinates>2.3,48.86</coordinates></Point></Placemark>`)
+
+	data, _, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Accept: "application/gpx+xml"}, &pgrest.Page{Slice: &clusters, Limit: 10, Count: 1})
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `<wpt lat="48.86" lon="2.3"></wpt>`)
+}
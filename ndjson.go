@@ -0,0 +1,45 @@
+package pgrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+)
+
+var ndjsonRegexp = regexp.MustCompile("[+-/]x?-?ndjson($|[+-;])")
+
+// NDJSONCodec structure, newline delimited JSON encoder, one line per entity
+type NDJSONCodec struct{}
+
+// MediaTypes implements Codec
+func (NDJSONCodec) MediaTypes() []string {
+	return []string{"application/x-ndjson", "application/ndjson"}
+}
+
+// Encode implements Codec, get slice queries are streamed by server with Engine.Stream
+func (NDJSONCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	if page, ok := entity.(*Page); ok {
+		entity = page.Slice
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	value := reflect.Indirect(reflect.ValueOf(entity))
+	if value.Kind() != reflect.Slice {
+		if err := encoder.Encode(entity); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	for i := 0; i < value.Len(); i++ {
+		if err := encoder.Encode(value.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements Codec
+func (NDJSONCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,76 @@
+package pgrest_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSON(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	config.AddResource(pgrest.NewResource("Book", (*Book)(nil), pgrest.All))
+	server := pgrest.NewServer(config)
+
+	var err error
+	var data []byte
+	var contentType string
+
+	books := []Book{{ID: 1, Title: "Le Procès"}, {ID: 2, Title: "Le Château"}}
+	data, contentType, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Accept: "application/x-ndjson"}, &pgrest.Page{Slice: &books, Count: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, "application/x-ndjson", contentType)
+	assert.Equal(t, "{\"ID\":1,\"Title\":\"Le Procès\",\"NbPages\":0,\"AuthorID\":0,\"Author\":null}\n{\"ID\":2,\"Title\":\"Le Château\",\"NbPages\":0,\"AuthorID\":0,\"Author\":null}\n", string(data))
+
+	err = server.Stream(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Relations: []*pgrest.Relation{{Name: "Author"}}}, &bytes.Buffer{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "relations", err.(*pgrest.Error).Param)
+
+	err = server.Stream(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Key: "1"}, &bytes.Buffer{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+}
+
+func TestStream(t *testing.T) {
+	db, config := initTests(t)
+	defer db.Close()
+	config.SetStreamMaxLimit(10)
+	server := pgrest.NewServer(config)
+
+	for _, book := range books {
+		_, err := server.Execute(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", ContentType: "application/json", Content: []byte(`{"Title":"` + book.Title + `"}`)})
+		assert.Nil(t, err)
+	}
+
+	var buf bytes.Buffer
+	err := server.Stream(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Sorts: []*pgrest.Sort{{Name: "id", Asc: true}}, Filter: &pgrest.Filter{Op: pgrest.Ilk, Attr: "title", Value: "%la%"}}, &buf)
+	assert.Nil(t, err)
+	var titles []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var book Book
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &book))
+		titles = append(titles, book.Title)
+	}
+	assert.Equal(t, []string{"La Métamorphose", "La Colonie pénitentiaire"}, titles)
+
+	req := httptest.NewRequest("GET", "/rest/Book", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	res := httptest.NewRecorder()
+	server.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/x-ndjson", res.Header().Get("Content-Type"))
+	assert.Equal(t, 10, bytes.Count(res.Body.Bytes(), []byte("\n")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req = httptest.NewRequest("GET", "/rest/Book", nil).WithContext(ctx)
+	err = server.Stream(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Request: req}, &bytes.Buffer{})
+	assert.NotNil(t, err)
+}
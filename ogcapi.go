@@ -0,0 +1,405 @@
+package pgrest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CRS84 is OGC API - Features default coordinate reference system URI (WGS 84 longitude/latitude)
+const CRS84 = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+
+var conformanceClasses = []string{
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson",
+	"http://www.opengis.net/spec/ogcapi-features-2/1.0/conf/crs",
+}
+
+// Link structure, OGC API link
+type Link struct {
+	Href  string `json:"href"`
+	Rel   string `json:"rel"`
+	Type  string `json:"type,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// LandingPage structure, OGC API landing page
+type LandingPage struct {
+	Title string  `json:"title"`
+	Links []*Link `json:"links"`
+}
+
+// Conformance structure, OGC API conformance declaration
+type Conformance struct {
+	ConformsTo []string `json:"conformsTo"`
+}
+
+// Collection structure, OGC API feature collection description
+type Collection struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	ItemType string   `json:"itemType"`
+	Crs      []string `json:"crs"`
+	Links    []*Link  `json:"links"`
+}
+
+// Collections structure, OGC API feature collections description
+type Collections struct {
+	Collections []*Collection `json:"collections"`
+	Links       []*Link       `json:"links"`
+}
+
+// ItemCollection structure, OGC API GeoJSON feature collection
+type ItemCollection struct {
+	Type           string     `json:"type"`
+	Features       []*Feature `json:"features"`
+	NumberMatched  int        `json:"numberMatched"`
+	NumberReturned int        `json:"numberReturned"`
+	TimeStamp      string     `json:"timeStamp"`
+	Links          []*Link    `json:"links"`
+}
+
+// FeaturesServer structure, OGC API - Features server of resources with geometry field
+type FeaturesServer struct {
+	Engine
+	prefix string
+	next   http.Handler
+}
+
+// NewFeaturesServer constructs FeaturesServer serving resources of config under prefix
+func NewFeaturesServer(config *Config, prefix string) *FeaturesServer {
+	s := new(FeaturesServer)
+	s.config = config
+	s.prefix = "/" + strings.Trim(prefix, "/") + "/"
+	if s.prefix == "//" {
+		s.prefix = "/"
+	}
+	return s
+}
+
+// Prefix gets prefix
+func (s *FeaturesServer) Prefix() string {
+	return s.prefix
+}
+
+// SetNextHandler sets next handler for middleware use
+func (s *FeaturesServer) SetNextHandler(next http.Handler) {
+	s.next = next
+}
+
+// ServeHTTP serves OGC API - Features request
+func (s *FeaturesServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	path := request.URL.Path
+	if !strings.HasPrefix(path+"/", s.prefix) || (request.Method != "GET" && request.Method != "HEAD") {
+		s.serveNext(writer, request)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path+"/", s.prefix), "/"), "/")
+	var res interface{}
+	var err error
+	contentType := "application/json; charset=utf-8"
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		res = s.landingPage(request)
+	case len(parts) == 1 && parts[0] == "conformance":
+		res = &Conformance{ConformsTo: conformanceClasses}
+	case len(parts) == 1 && parts[0] == "collections":
+		res = s.collections(request)
+	case len(parts) == 2 && parts[0] == "collections":
+		res, err = s.collection(request, parts[1])
+	case len(parts) == 3 && parts[0] == "collections" && parts[2] == "items":
+		res, err = s.items(writer, request, parts[1])
+		contentType = "application/geo+json; charset=utf-8"
+	case len(parts) == 4 && parts[0] == "collections" && parts[2] == "items":
+		res, err = s.item(writer, request, parts[1], parts[3])
+		contentType = "application/geo+json; charset=utf-8"
+	default:
+		s.serveNext(writer, request)
+		return
+	}
+	if err != nil {
+		s.writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		s.writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", contentType)
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(data)
+}
+
+func (s *FeaturesServer) serveNext(writer http.ResponseWriter, request *http.Request) {
+	if s.next != nil {
+		s.next.ServeHTTP(writer, request)
+	} else {
+		http.Error(writer, "Resource not found", http.StatusNotFound)
+	}
+}
+
+// featureResources gets resources readable as features, sorted by name
+func (s *FeaturesServer) featureResources() []*Resource {
+	resources := make([]*Resource, 0)
+	for _, resource := range s.Config().resources {
+		if s.isFeatureResource(resource) {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name() < resources[j].Name() })
+	return resources
+}
+
+// isFeatureResource checks that resource has geometry field and allows Get action
+func (s *FeaturesServer) isFeatureResource(resource *Resource) bool {
+	return resource != nil && resource.Action()&Get != 0 && resource.GeometryField() != ""
+}
+
+// getFeatureResource gets resource of collection
+func (s *FeaturesServer) getFeatureResource(name string) (*Resource, error) {
+	resource := s.Config().GetResource(name)
+	if !s.isFeatureResource(resource) {
+		return nil, &Error{Message: fmt.Sprintf("collection '%v' not found", name), Code: 404}
+	}
+	return resource, nil
+}
+
+func (s *FeaturesServer) landingPage(request *http.Request) *LandingPage {
+	base := s.baseURL(request)
+	return &LandingPage{Title: "pgrest", Links: []*Link{
+		{Href: base, Rel: "self", Type: "application/json", Title: "This document"},
+		{Href: base + "conformance", Rel: "conformance", Type: "application/json", Title: "Conformance classes"},
+		{Href: base + "collections", Rel: "data", Type: "application/json", Title: "Feature collections"},
+	}}
+}
+
+func (s *FeaturesServer) collections(request *http.Request) *Collections {
+	base := s.baseURL(request)
+	collections := &Collections{Collections: make([]*Collection, 0), Links: []*Link{{Href: base + "collections", Rel: "self", Type: "application/json"}}}
+	for _, resource := range s.featureResources() {
+		collections.Collections = append(collections.Collections, s.newCollection(base, resource))
+	}
+	return collections
+}
+
+func (s *FeaturesServer) collection(request *http.Request, name string) (*Collection, error) {
+	resource, err := s.getFeatureResource(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.newCollection(s.baseURL(request), resource), nil
+}
+
+func (s *FeaturesServer) newCollection(base string, resource *Resource) *Collection {
+	href := base + "collections/" + url.PathEscape(resource.Name())
+	return &Collection{ID: resource.Name(), Title: resource.Name(), ItemType: "feature", Crs: []string{CRS84, "*"}, Links: []*Link{
+		{Href: href, Rel: "self", Type: "application/json"},
+		{Href: href + "/items", Rel: "items", Type: "application/geo+json"},
+	}}
+}
+
+func (s *FeaturesServer) items(writer http.ResponseWriter, request *http.Request, name string) (*ItemCollection, error) {
+	resource, err := s.getFeatureResource(name)
+	if err != nil {
+		return nil, err
+	}
+	restQuery, err := s.newRestQuery(request, resource)
+	if err != nil {
+		return nil, err
+	}
+	params := request.URL.Query()
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return nil, NewErrorParam("limit", errors.New("must be a positive integer"))
+		}
+		restQuery.Limit = limit
+	}
+	if offsetStr := params.Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return nil, NewErrorParam("offset", errors.New("must be a non negative integer"))
+		}
+		restQuery.Offset = offset
+	}
+	filters := make([]*Filter, 0)
+	if bboxStr := strings.TrimSpace(params.Get("bbox")); bboxStr != "" {
+		bboxSRID := DefaultSRID
+		if bboxCrsStr := params.Get("bbox-crs"); bboxCrsStr != "" {
+			if bboxSRID, err = ParseCrs(bboxCrsStr); err != nil {
+				return nil, NewErrorParam("bbox-crs", err)
+			}
+		}
+		if strings.Count(bboxStr, ",") != 3 {
+			return nil, NewErrorParam("bbox", errors.New("bounding box 'minx,miny,maxx,maxy' expected"))
+		}
+		envelope, err := parseEnvelope(bboxStr, bboxSRID)
+		if err != nil {
+			return nil, NewErrorParam("bbox", err)
+		}
+		filters = append(filters, &Filter{Op: Bbox, Attr: resource.GeometryField(), Value: envelope})
+	}
+	if datetimeStr := strings.TrimSpace(params.Get("datetime")); datetimeStr != "" {
+		if resource.TemporalField() == "" {
+			return nil, NewErrorParam("datetime", fmt.Errorf("collection '%v' without temporal field", resource.Name()))
+		}
+		datetimeFilters, err := decodeDatetime(datetimeStr, resource.TemporalField())
+		if err != nil {
+			return nil, NewErrorParam("datetime", err)
+		}
+		filters = append(filters, datetimeFilters...)
+	}
+	if len(filters) == 1 {
+		restQuery.Filter = filters[0]
+	} else if len(filters) > 1 {
+		restQuery.Filter = &Filter{Op: And, Filters: filters}
+	}
+	res, err := s.Execute(restQuery)
+	if err != nil {
+		return nil, err
+	}
+	page := res.(*Page)
+	fc, err := NewFeatureCollection(page, resource)
+	if err != nil {
+		return nil, err
+	}
+	base := s.baseURL(request) + "collections/" + url.PathEscape(name) + "/items"
+	items := &ItemCollection{Type: "FeatureCollection", Features: fc.Features, NumberMatched: page.Count, NumberReturned: len(fc.Features), TimeStamp: time.Now().UTC().Format(time.RFC3339)}
+	items.Links = []*Link{{Href: pageHref(base, params, page.Offset, page.Limit), Rel: "self", Type: "application/geo+json"}}
+	if page.Offset > 0 {
+		prevOffset := page.Offset - page.Limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		items.Links = append(items.Links, &Link{Href: pageHref(base, params, prevOffset, page.Limit), Rel: "prev", Type: "application/geo+json"})
+	}
+	if page.Offset+items.NumberReturned < page.Count {
+		items.Links = append(items.Links, &Link{Href: pageHref(base, params, page.Offset+items.NumberReturned, page.Limit), Rel: "next", Type: "application/geo+json"})
+	}
+	items.Links = append(items.Links, &Link{Href: strings.TrimSuffix(base, "/items"), Rel: "collection", Type: "application/json"})
+	for _, feature := range items.Features {
+		if feature.ID != nil {
+			feature.Links = []*Link{{Href: base + "/" + url.PathEscape(fmt.Sprint(feature.ID)), Rel: "self", Type: "application/geo+json"}}
+		}
+	}
+	s.setContentCrs(writer, restQuery)
+	return items, nil
+}
+
+func (s *FeaturesServer) item(writer http.ResponseWriter, request *http.Request, name string, key string) (*Feature, error) {
+	resource, err := s.getFeatureResource(name)
+	if err != nil {
+		return nil, err
+	}
+	restQuery, err := s.newRestQuery(request, resource)
+	if err != nil {
+		return nil, err
+	}
+	restQuery.Key = key
+	res, err := s.Execute(restQuery)
+	if err != nil {
+		return nil, err
+	}
+	feature, err := NewFeature(res, resource)
+	if err != nil {
+		return nil, err
+	}
+	base := s.baseURL(request) + "collections/" + url.PathEscape(name)
+	feature.Links = []*Link{
+		{Href: base + "/items/" + url.PathEscape(key), Rel: "self", Type: "application/geo+json"},
+		{Href: base, Rel: "collection", Type: "application/json"},
+	}
+	s.setContentCrs(writer, restQuery)
+	return feature, nil
+}
+
+// newRestQuery constructs rest query reading resource as GeoJSON in requested crs (CRS84 by default)
+func (s *FeaturesServer) newRestQuery(request *http.Request, resource *Resource) (*RestQuery, error) {
+	restQuery := &RestQuery{Request: request, Action: Get, Resource: resource.Name(), Accept: "application/geo+json", ContentType: s.Config().DefaultContentType(), Limit: s.Config().resourceDefaultLimit(resource), Fields: []*Field{}, Relations: []*Relation{}, Sorts: []*Sort{}, Filter: &Filter{}, Crs: DefaultSRID}
+	if crsStr := request.URL.Query().Get("crs"); crsStr != "" {
+		crs, err := ParseCrs(crsStr)
+		if err != nil {
+			return nil, NewErrorParam("crs", err)
+		}
+		restQuery.Crs = crs
+	}
+	return restQuery, nil
+}
+
+// setContentCrs sets Content-Crs header of response
+func (s *FeaturesServer) setContentCrs(writer http.ResponseWriter, restQuery *RestQuery) {
+	crs := CRS84
+	if crsStr := restQuery.Request.URL.Query().Get("crs"); crsStr != "" && restQuery.Crs != DefaultSRID {
+		crs = CrsURI(restQuery.Crs)
+	}
+	writer.Header().Set("Content-Crs", "<"+crs+">")
+}
+
+// baseURL gets absolute URL of prefix
+func (s *FeaturesServer) baseURL(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := request.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + request.Host + s.prefix
+}
+
+// pageHref gets items URL with query parameters and page offset and limit
+func pageHref(base string, params url.Values, offset int, limit int) string {
+	values := url.Values{}
+	for k, v := range params {
+		values[k] = v
+	}
+	values.Set("offset", strconv.Itoa(offset))
+	values.Set("limit", strconv.Itoa(limit))
+	return base + "?" + values.Encode()
+}
+
+var datetimeRegexp = regexp.MustCompile(`^[^/]*(/[^/]*)?$`)
+
+// decodeDatetime decodes OGC API datetime instant ('2018-02-12T23:20:50Z') or interval ('2018-02-12T00:00:00Z/..') into filters
+func decodeDatetime(str string, attr string) ([]*Filter, error) {
+	if !datetimeRegexp.MatchString(str) {
+		return nil, fmt.Errorf("invalid datetime '%v'", str)
+	}
+	bounds := strings.Split(str, "/")
+	times := make([]*time.Time, len(bounds))
+	for i, bound := range bounds {
+		if bound == "" || bound == ".." {
+			if len(bounds) == 1 {
+				return nil, fmt.Errorf("invalid datetime '%v'", str)
+			}
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound)
+		if err != nil {
+			return nil, err
+		}
+		times[i] = &t
+	}
+	if len(times) == 1 {
+		return []*Filter{{Op: Eq, Attr: attr, Value: *times[0]}}, nil
+	}
+	filters := make([]*Filter, 0)
+	if times[0] != nil {
+		filters = append(filters, &Filter{Op: Gte, Attr: attr, Value: *times[0]})
+	}
+	if times[1] != nil {
+		filters = append(filters, &Filter{Op: Lte, Attr: attr, Value: *times[1]})
+	}
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("invalid datetime '%v'", str)
+	}
+	return filters, nil
+}
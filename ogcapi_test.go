@@ -0,0 +1,109 @@
+package pgrest_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/stretchr/testify/assert"
+)
+
+func getJSON(t *testing.T, url string, v interface{}) *http.Response {
+	res, err := http.Get(url)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Nil(t, res.Body.Close())
+	if res.StatusCode == http.StatusOK && v != nil {
+		assert.Nil(t, json.Unmarshal(body, v))
+	}
+	return res
+}
+
+func TestFeaturesServerMetadata(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	config.AddResource(pgrest.NewResource("Book", (*Book)(nil), pgrest.All))
+	config.AddResource(pgrest.NewResource("Place", (*Place)(nil), pgrest.All))
+	config.AddResource(pgrest.NewResource("HiddenPlace", (*Place)(nil), pgrest.Post))
+	ts := httptest.NewServer(pgrest.NewFeaturesServer(config, "/ogc"))
+	defer ts.Close()
+
+	var res *http.Response
+	var landingPage pgrest.LandingPage
+	var conformance pgrest.Conformance
+	var collections pgrest.Collections
+	var collection pgrest.Collection
+
+	res = getJSON(t, ts.URL+"/ogc/", &landingPage)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Equal(t, ts.URL+"/ogc/collections", landingPage.Links[2].Href)
+
+	res = getJSON(t, ts.URL+"/ogc/conformance", &conformance)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, conformance.ConformsTo, "http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core")
+
+	res = getJSON(t, ts.URL+"/ogc/collections", &collections)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 1, len(collections.Collections))
+	assert.Equal(t, "Place", collections.Collections[0].ID)
+
+	res = getJSON(t, ts.URL+"/ogc/collections/Place", &collection)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "feature", collection.ItemType)
+	assert.Equal(t, ts.URL+"/ogc/collections/Place/items", collection.Links[1].Href)
+
+	res = getJSON(t, ts.URL+"/ogc/collections/Book", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res = getJSON(t, ts.URL+"/ogc/collections/HiddenPlace/items", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res = getJSON(t, ts.URL+"/ogc/collections/Place/items?limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = getJSON(t, ts.URL+"/ogc/collections/Place/items?bbox=1,2,3", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = getJSON(t, ts.URL+"/ogc/collections/Place/items?crs=WGS84", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = getJSON(t, ts.URL+"/ogc/collections/Place/items?datetime=2018-02-12T23:20:50Z", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = getJSON(t, ts.URL+"/rest/Place", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestFeaturesServerItems(t *testing.T) {
+	db, config := initTests(t)
+	defer db.Close()
+	ts := httptest.NewServer(pgrest.NewFeaturesServer(config, "/ogc/"))
+	defer ts.Close()
+
+	var err error
+	var res *http.Response
+	var items pgrest.ItemCollection
+	var feature pgrest.Feature
+
+	_, err = db.Exec("CREATE EXTENSION IF NOT EXISTS postgis")
+	assert.Nil(t, err)
+	err = db.Model((*Place)(nil)).CreateTable(&orm.CreateTableOptions{Temp: true})
+	assert.Nil(t, err)
+	_, err = db.Exec("INSERT INTO places (name, geom) VALUES ('Eiffel', ST_SetSRID(ST_MakePoint(2.2945, 48.8584), 4326)), ('Louvre', ST_SetSRID(ST_MakePoint(2.3376, 48.8606), 4326)), ('Colosseo', ST_SetSRID(ST_MakePoint(12.4922, 41.8902), 4326))")
+	assert.Nil(t, err)
+
+	res = getJSON(t, ts.URL+"/ogc/collections/Place/items?limit=1&bbox=2.2,48.8,2.5,48.9", &items)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/geo+json; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Equal(t, "<"+pgrest.CRS84+">", res.Header.Get("Content-Crs"))
+	assert.Equal(t, 2, items.NumberMatched)
+	assert.Equal(t, 1, items.NumberReturned)
+	assert.Equal(t, "next", items.Links[1].Rel)
+
+	res = getJSON(t, ts.URL+"/ogc/collections/Place/items/1?crs=EPSG:3857", &feature)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "<http://www.opengis.net/def/crs/EPSG/0/3857>", res.Header.Get("Content-Crs"))
+	assert.Equal(t, "Eiffel", feature.Properties["Name"])
+
+	res = getJSON(t, ts.URL+"/ogc/collections/Place/items/100", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
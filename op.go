@@ -44,8 +44,30 @@ const (
 	Null Op = "null"
 	// Nnull operation for attribute (? IS NOT NULL)
 	Nnull Op = "nnull"
+	// Similar operation for attribute (? % ?), needs pg_trgm extension
+	Similar Op = "similar"
+	// Wsimilar operation for attribute (? %> ?), word similarity, needs pg_trgm extension
+	Wsimilar Op = "wsimilar"
+	// Intersects operation for geometry attribute (ST_Intersects(?, ?)), needs postgis extension
+	Intersects Op = "intersects"
+	// Within operation for geometry attribute (ST_Within(?, ?)), needs postgis extension
+	Within Op = "within"
+	// Contains operation for geometry attribute (ST_Contains(?, ?)), needs postgis extension
+	Contains Op = "contains"
+	// Dwithin operation for geometry attribute (ST_DWithin(?, ?, ?)), needs postgis extension
+	Dwithin Op = "dwithin"
+	// Bbox operation for geometry attribute (? && ST_MakeEnvelope(?)), needs postgis extension
+	Bbox Op = "bbox"
 )
 
 func (o Op) String() string {
 	return string(o)
 }
+
+func (o Op) valid() bool {
+	switch o {
+	case And, Or, Eq, Neq, In, Nin, Gt, Gte, Lt, Lte, Lk, Nlk, Ilk, Nilk, Sim, Nsim, Ilkua, Nilkua, Null, Nnull, Similar, Wsimilar, Intersects, Within, Contains, Dwithin, Bbox:
+		return true
+	}
+	return false
+}
@@ -2,6 +2,9 @@ package pgrest
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"regexp"
@@ -9,8 +12,20 @@ import (
 	"strings"
 )
 
-// RequestDecoder decodes rest parameters from request
+// RequestDecoder decodes rest parameters from request, returns nil rest query if request isn't rest request
+// or can't be decoded
+//
+// Deprecated: use DecodeRequest, which reports decoding errors
 func RequestDecoder(request *http.Request, config *Config) *RestQuery {
+	restQuery, err := DecodeRequest(request, config)
+	if err != nil {
+		return nil
+	}
+	return restQuery
+}
+
+// DecodeRequest decodes rest parameters from request, returns nil rest query if request isn't rest request
+func DecodeRequest(request *http.Request, config *Config) (*RestQuery, error) {
 	re := regexp.MustCompile("(" + config.Prefix() + ")([^/\\?]+)/?([^/\\?]+)?/?([^/\\?]+)?")
 	res := re.FindStringSubmatch(request.RequestURI)
 	action := None
@@ -25,14 +40,58 @@ func RequestDecoder(request *http.Request, config *Config) *RestQuery {
 	} else if request.Method == "DELETE" {
 		action = Delete
 	}
+	var tile *Tile
+	if action == Get {
+		var tres []string
+		if strings.HasPrefix(request.URL.Path, config.Prefix()) {
+			tres = tileRegexp.FindStringSubmatch(request.URL.Path[len(config.Prefix()):])
+		}
+		if tres != nil {
+			var err error
+			tile, err = decodeTile(tres[2], tres[3], tres[4])
+			if err != nil {
+				return nil, NewErrorParam("tile", err)
+			}
+			res = []string{request.URL.Path, config.Prefix(), tres[1], "", ""}
+		}
+	}
 	if res != nil && res[4] == "" && action != None {
-		restQuery := &RestQuery{Request: request, Action: action, Offset: 0, Limit: 10}
+		restQuery := &RestQuery{Request: request, Action: action, Offset: 0, Tile: tile}
 		restQuery.Resource = res[2]
 		restQuery.Key = res[3]
-
+		resource := config.GetResource(restQuery.Resource)
 		params := request.URL.Query()
+		restQuery.Limit = config.resourceDefaultLimit(resource)
+		if restQuery.Key == CopyKey && (action == Get || action == Post) {
+			restQuery.Key = ""
+			restQuery.Copy = CopyCSV
+			if formatStr := strings.TrimSpace(params.Get("format")); formatStr != "" {
+				restQuery.Copy = CopyFormat(strings.ToLower(formatStr))
+				if !restQuery.Copy.valid() {
+					return nil, NewErrorParam("format", fmt.Errorf("unknown COPY format '%v'", formatStr))
+				}
+			}
+		}
 
-		restQuery.Content, _ = ioutil.ReadAll(request.Body)
+		maxBodySize := config.MaxBodySize()
+		if resource != nil && resource.MaxBodySize() > 0 {
+			maxBodySize = resource.MaxBodySize()
+		}
+		if request.Body != nil && (restQuery.Copy == "" || action != Post) {
+			// COPY import body is streamed to database
+			var err error
+			if maxBodySize > 0 {
+				restQuery.Content, err = ioutil.ReadAll(io.LimitReader(request.Body, maxBodySize+1))
+			} else {
+				restQuery.Content, err = ioutil.ReadAll(request.Body)
+			}
+			if err != nil {
+				return nil, NewErrorBadRequest(fmt.Sprintf("unable to read request body (%v)", err))
+			}
+			if maxBodySize > 0 && int64(len(restQuery.Content)) > maxBodySize {
+				return nil, NewErrorRequestTooLarge(fmt.Sprintf("request body exceeds %v bytes", maxBodySize))
+			}
+		}
 
 		restQuery.ContentType = request.Header.Get("Content-Type")
 		if restQuery.ContentType == "" {
@@ -43,12 +102,46 @@ func RequestDecoder(request *http.Request, config *Config) *RestQuery {
 		if restQuery.Accept == "" {
 			restQuery.Accept = config.DefaultAccept()
 		}
+		if tile == nil && (restQuery.Copy == "" || action == Post) {
+			// Accept is replaced by negotiated media type
+			_, mediaType, err := config.negotiateCodec(restQuery.Accept, resource)
+			if err != nil {
+				return nil, err
+			}
+			restQuery.Accept = mediaType
+			if csvRegexp.MatchString(restQuery.Accept) || xlsxRegexp.MatchString(restQuery.Accept) {
+				// CSV and XLSX export full filtered result up to maximum limit
+				restQuery.Limit = config.CSVMaxLimit()
+			} else if ndjsonRegexp.MatchString(restQuery.Accept) {
+				// NDJSON streams full filtered result up to maximum limit
+				restQuery.Limit = config.StreamMaxLimit()
+			}
+		}
+		if (action == Post && restQuery.Copy == "") || action == Put || action == Patch {
+			if _, err := config.decodingCodec(restQuery.ContentType); err != nil {
+				return nil, err
+			}
+		}
 
-		if offset, err := strconv.ParseInt(params.Get("offset"), 10, 64); err == nil {
+		if offsetStr := params.Get("offset"); offsetStr != "" {
+			offset, err := strconv.ParseInt(offsetStr, 10, 32)
+			if err != nil {
+				return nil, NewErrorParam("offset", err)
+			}
+			if offset < 0 {
+				return nil, NewErrorParam("offset", errors.New("must not be negative"))
+			}
 			restQuery.Offset = int(offset)
 		}
 
-		if limit, err := strconv.ParseInt(params.Get("limit"), 10, 64); err == nil {
+		if limitStr := params.Get("limit"); limitStr != "" {
+			limit, err := strconv.ParseInt(limitStr, 10, 32)
+			if err != nil {
+				return nil, NewErrorParam("limit", err)
+			}
+			if limit < 0 {
+				return nil, NewErrorParam("limit", errors.New("must not be negative"))
+			}
 			restQuery.Limit = int(limit)
 		}
 
@@ -73,23 +166,109 @@ func RequestDecoder(request *http.Request, config *Config) *RestQuery {
 		}
 
 		sortStr := strings.TrimSpace(params.Get("sort"))
-		sortStrs := strings.Split(sortStr, ",")
+		sortStrs := splitParam(sortStr)
 		restQuery.Sorts = make([]*Sort, 0)
 		for _, s := range sortStrs {
 			st := strings.TrimSpace(s)
 			if st != "" {
-				if strings.HasPrefix(s, "-") {
-					restQuery.Sorts = append(restQuery.Sorts, &Sort{st[1:], false})
-				} else {
-					restQuery.Sorts = append(restQuery.Sorts, &Sort{st, true})
+				sort, err := decodeSort(st)
+				if err != nil {
+					return nil, NewErrorParam("sort", err)
 				}
+				restQuery.Sorts = append(restQuery.Sorts, sort)
 			}
 		}
 
 		filterStr := strings.TrimSpace(params.Get("filter"))
 		restQuery.Filter = &Filter{}
 		if strings.HasPrefix(filterStr, "{") {
-			json.Unmarshal([]byte(filterStr), restQuery.Filter)
+			if err := json.Unmarshal([]byte(filterStr), restQuery.Filter); err != nil {
+				return nil, NewErrorParam("filter", err)
+			}
+		} else if filterStr != "" {
+			filter, err := ParseFilter(filterStr)
+			if err != nil {
+				return nil, NewErrorParam("filter", err)
+			}
+			restQuery.Filter = filter
+		}
+		if err := restQuery.Filter.Validate(); err != nil {
+			return nil, NewErrorParam("filter", err)
+		}
+
+		// Coordinate reference system from crs or Accept-Crs header
+		crsStr := strings.TrimSpace(params.Get("crs"))
+		crsParam := "crs"
+		if crsStr == "" {
+			crsStr = strings.TrimSpace(request.Header.Get("Accept-Crs"))
+			crsParam = "Accept-Crs"
+		}
+		if crsStr != "" {
+			crs, err := ParseCrs(crsStr)
+			if err != nil {
+				return nil, NewErrorParam(crsParam, err)
+			}
+			restQuery.Crs = crs
+		}
+
+		if bboxStr := strings.TrimSpace(params.Get("bbox")); bboxStr != "" {
+			envelope, err := parseEnvelope(bboxStr, restQuery.inputSRID())
+			if err != nil {
+				return nil, NewErrorParam("bbox", err)
+			}
+			if resource == nil || resource.GeometryField() == "" {
+				return nil, NewErrorParam("bbox", fmt.Errorf("resource '%v' without geometry field", restQuery.Resource))
+			}
+			bboxFilter := &Filter{Op: Bbox, Attr: resource.GeometryField(), Value: envelope}
+			if restQuery.Filter.Op == "" {
+				restQuery.Filter = bboxFilter
+			} else {
+				restQuery.Filter = &Filter{Op: And, Filters: []*Filter{bboxFilter, restQuery.Filter}}
+			}
+		}
+
+		if clusterStr := strings.TrimSpace(params.Get("cluster")); clusterStr != "" && restQuery.Key == "" {
+			cluster, err := decodeCluster(clusterStr, params.Get("cellSize"), params.Get("k"), params.Get("aggregates"))
+			if err != nil {
+				return nil, err
+			}
+			restQuery.Cluster = cluster
+		}
+
+		if maxDistanceStr := params.Get("maxDistance"); maxDistanceStr != "" {
+			maxDistance, err := strconv.ParseFloat(maxDistanceStr, 64)
+			if err != nil {
+				return nil, NewErrorParam("maxDistance", err)
+			}
+			if maxDistance < 0 {
+				return nil, NewErrorParam("maxDistance", errors.New("must not be negative"))
+			}
+			var distanceFilter *Filter
+			for _, sort := range restQuery.Sorts {
+				if sort.Func == Distance {
+					distanceFilter = &Filter{Op: Dwithin, Attr: sort.Name, Value: []interface{}{sort.Value, maxDistance}}
+					break
+				}
+			}
+			if distanceFilter == nil {
+				return nil, NewErrorParam("maxDistance", errors.New("distance sort is mandatory"))
+			}
+			if restQuery.Filter.Op == "" {
+				restQuery.Filter = distanceFilter
+			} else {
+				restQuery.Filter = &Filter{Op: And, Filters: []*Filter{distanceFilter, restQuery.Filter}}
+			}
+		}
+
+		if thresholdStr := params.Get("threshold"); thresholdStr != "" {
+			threshold, err := strconv.ParseFloat(thresholdStr, 64)
+			if err != nil {
+				return nil, NewErrorParam("threshold", err)
+			}
+			if threshold < 0 || threshold > 1 {
+				return nil, NewErrorParam("threshold", errors.New("must be between 0 and 1"))
+			}
+			restQuery.Threshold = threshold
 		}
 
 		// Search path from searchpath, searchPath or search_path
@@ -101,11 +280,93 @@ func RequestDecoder(request *http.Request, config *Config) *RestQuery {
 			restQuery.SearchPath = strings.TrimSpace(params.Get("search_path"))
 		}
 
-		if debug, err := strconv.ParseBool(params.Get("debug")); err == nil {
+		if debugStr := params.Get("debug"); debugStr != "" {
+			debug, err := strconv.ParseBool(debugStr)
+			if err != nil {
+				return nil, NewErrorParam("debug", err)
+			}
 			restQuery.Debug = debug
 		}
 
-		return restQuery
+		return restQuery, nil
+	}
+	return nil, nil
+}
+
+// decodeTile decodes zoom level and tile coordinates
+func decodeTile(zStr string, xStr string, yStr string) (*Tile, error) {
+	z, err := strconv.Atoi(zStr)
+	if err != nil {
+		return nil, err
+	}
+	x, err := strconv.Atoi(xStr)
+	if err != nil {
+		return nil, err
+	}
+	y, err := strconv.Atoi(yStr)
+	if err != nil {
+		return nil, err
+	}
+	tile := &Tile{Z: z, X: x, Y: y}
+	if err = tile.validate(); err != nil {
+		return nil, err
+	}
+	return tile, nil
+}
+
+// tileRegexp matches tile path after prefix ('{resource}/tiles/{z}/{x}/{y}.mvt')
+var tileRegexp = regexp.MustCompile(`^([^/?]+)/tiles/(\d+)/(\d+)/(\d+)\.mvt$`)
+
+var sortFuncRegexp = regexp.MustCompile(`^(\w+)\(\s*([^,\s]+)\s*,\s*(.*)\)(?:\s+as\s+(\w+))?$`)
+
+// decodeSort decodes 'name', '-name' or 'func(name, value) [as alias]'
+func decodeSort(str string) (*Sort, error) {
+	sort := &Sort{Name: str, Asc: true}
+	if strings.HasPrefix(str, "-") {
+		sort.Name = strings.TrimSpace(str[1:])
+		sort.Asc = false
+	}
+	if res := sortFuncRegexp.FindStringSubmatch(sort.Name); res != nil {
+		sort.Func = SortFunc(strings.ToLower(res[1]))
+		if !sort.Func.valid() {
+			return nil, fmt.Errorf("unknown sort function '%v'", res[1])
+		}
+		sort.Name = res[2]
+		sort.Value = unquote(strings.TrimSpace(res[3]))
+		sort.Alias = res[4]
+	} else if strings.ContainsAny(sort.Name, "() '\"") {
+		return nil, fmt.Errorf("invalid sort '%v'", str)
+	}
+	return sort, nil
+}
+
+// splitParam splits comma separated parameter, ignoring commas between parentheses or quotes
+func splitParam(str string) []string {
+	parts := make([]string, 0)
+	depth := 0
+	quoted := false
+	start := 0
+	for i, r := range str {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, str[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, str[start:])
+}
+
+// unquote removes single quotes around str and unescapes doubled quotes
+func unquote(str string) string {
+	if len(str) >= 2 && strings.HasPrefix(str, "'") && strings.HasSuffix(str, "'") {
+		return strings.Replace(str[1:len(str)-1], "''", "'", -1)
 	}
-	return nil
+	return str
 }
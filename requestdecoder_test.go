@@ -13,8 +13,16 @@ import (
 
 func decodeHandler(prefix string) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		restQuery := pgrest.RequestDecoder(r, pgrest.NewConfig("/rest/", nil))
-		if restQuery != nil {
+		config := pgrest.NewConfig("/rest/", nil)
+		resource := pgrest.NewResource("Book", (*Book)(nil), pgrest.All)
+		resource.SetMaxBodySize(16)
+		resource.SetDefaultLimit(20)
+		config.AddResource(resource)
+		config.AddResource(pgrest.NewResource("Place", (*Place)(nil), pgrest.All))
+		restQuery, err := pgrest.DecodeRequest(r, config)
+		if err != nil {
+			http.Error(w, err.Error(), err.(*pgrest.Error).StatusCode())
+		} else if restQuery != nil {
 			w.Write([]byte(restQuery.String()))
 		}
 	})
@@ -33,7 +41,17 @@ var requestDecoderTests = []struct {
 	{"/rest/User?offset=60&limit=10&sort=lastname&fields=user.*,user.roles", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "User", Offset: 60, Limit: 10, Fields: []*pgrest.Field{{Name: "user.*"}, {Name: "user.roles"}}, Sorts: []*pgrest.Sort{{Name: "lastname", Asc: true}}, Filter: &pgrest.Filter{}}},
 	{"/rest/User?filter=%7B%22Op%22%3A%22ilk%22%2C%22Attr%22%3A%22title%22%2C%22Value%22%3A%22%25lo%25%22%7D", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "User", Offset: 0, Limit: 10, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{}, Filter: &pgrest.Filter{Op: pgrest.Ilk, Attr: "title", Value: "%lo%"}}},
 	{"/rest/User?filter=%7B%22Op%22%3A%22in%22%2C%22Attr%22%3A%22title%22%2C%22Value%22%3A%5B%22Titre+1%22%2C%22Titre+2%22%5D%7D", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "User", Offset: 0, Limit: 10, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{}, Filter: &pgrest.Filter{Op: pgrest.In, Attr: "title", Value: []string{"Titre 1", "Titre 2"}}}},
+	{"/rest/User?sort=similarity(lastname,%27kafak%27)+as+score,-firstname", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "User", Offset: 0, Limit: 10, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{{Name: "lastname", Asc: true, Func: pgrest.Similarity, Value: "kafak", Alias: "score"}, {Name: "firstname", Asc: false}}, Filter: &pgrest.Filter{}}},
+	{"/rest/User?filter=NbPages+gt+100+and+(Title+ilk+%27%25prince%25%27+or+AuthorID+in+(1,2))", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "User", Offset: 0, Limit: 10, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{}, Filter: &pgrest.Filter{Op: pgrest.And, Filters: []*pgrest.Filter{{Op: pgrest.Gt, Attr: "NbPages", Value: 100}, {Op: pgrest.Or, Filters: []*pgrest.Filter{{Op: pgrest.Ilk, Attr: "Title", Value: "%prince%"}, {Op: pgrest.In, Attr: "AuthorID", Value: []int{1, 2}}}}}}}},
+	{"/rest/Book", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Offset: 0, Limit: 20, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{}, Filter: &pgrest.Filter{}}},
+	{"/rest/Place?bbox=2.2,48.8,2.5,48.9&filter=name+ilk+%27%25tour%25%27", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Offset: 0, Limit: 10, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{}, Filter: &pgrest.Filter{Op: pgrest.And, Filters: []*pgrest.Filter{{Op: pgrest.Bbox, Attr: "geom", Value: []float64{2.2, 48.8, 2.5, 48.9, 4326}}, {Op: pgrest.Ilk, Attr: "name", Value: "%tour%"}}}}},
+	{"/rest/Place/tiles/12/2074/1409.mvt?filter=name+ilk+%27%25tour%25%27", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Offset: 0, Limit: 10, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{}, Filter: &pgrest.Filter{Op: pgrest.Ilk, Attr: "name", Value: "%tour%"}, Tile: &pgrest.Tile{Z: 12, X: 2074, Y: 1409}}},
+	{"/rest/Place?sort=distance(geom,POINT(2.35+48.85))+as+distance&maxDistance=0.1", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Offset: 0, Limit: 10, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{{Name: "geom", Asc: true, Func: pgrest.Distance, Value: "POINT(2.35 48.85)", Alias: "distance"}}, Filter: &pgrest.Filter{Op: pgrest.Dwithin, Attr: "geom", Value: []interface{}{"POINT(2.35 48.85)", 0.1}}}},
+	{"/rest/Place?crs=EPSG:3857&bbox=261700,6250000,278300,6257000", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Offset: 0, Limit: 10, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{}, Filter: &pgrest.Filter{Op: pgrest.Bbox, Attr: "geom", Value: []float64{261700, 6250000, 278300, 6257000, 3857}}, Crs: 3857}},
+	{"/rest/Place?cluster=grid&cellSize=0.5&aggregates=count(id),max(name)", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "Place", Offset: 0, Limit: 10, Fields: []*pgrest.Field{}, Sorts: []*pgrest.Sort{}, Filter: &pgrest.Filter{}, Cluster: &pgrest.Cluster{Method: pgrest.Grid, CellSize: 0.5, Aggregates: []*pgrest.Aggregate{{Func: pgrest.Count, Name: "id"}, {Func: pgrest.Max, Name: "name"}}}}},
+	{"/rest/Book/_copy?format=binary&fields=id,title", "GET", &pgrest.RestQuery{Action: pgrest.Get, Resource: "Book", Offset: 0, Limit: 20, Fields: []*pgrest.Field{{Name: "id"}, {Name: "title"}}, Sorts: []*pgrest.Sort{}, Filter: &pgrest.Filter{}, Copy: pgrest.CopyBinary}},
 	{"/rest/User", "POST", &pgrest.RestQuery{Action: pgrest.Post, Resource: "User", ContentType: "application/json"}},
+	{"/rest/Book/_copy", "POST", &pgrest.RestQuery{Action: pgrest.Post, Resource: "Book", ContentType: "application/json", Copy: pgrest.CopyCSV}},
 	{"/rest/User/1", "PUT", &pgrest.RestQuery{Action: pgrest.Put, Resource: "User", Key: "1", ContentType: "application/json"}},
 	{"/rest/User/1", "PATCH", &pgrest.RestQuery{Action: pgrest.Patch, Resource: "User", Key: "1", ContentType: "application/json"}},
 	{"/rest/User/1", "DELETE", &pgrest.RestQuery{Action: pgrest.Delete, Resource: "User", Key: "1"}},
@@ -62,3 +80,61 @@ func TestRequestDecoder(t *testing.T) {
 		}
 	}
 }
+
+var requestDecoderErrorTests = []struct {
+	uri      string
+	method   string
+	body     string
+	code     int
+	expected string
+}{
+	{"/rest/User?offset=abc", "GET", "", 400, "'offset'"},
+	{"/rest/User?offset=-10", "GET", "", 400, "'offset'"},
+	{"/rest/User?limit=ten", "GET", "", 400, "'limit'"},
+	{"/rest/User?limit=-1", "GET", "", 400, "'limit'"},
+	{"/rest/User?filter=%7B%22Op%22%3A%22ilk%22%2C", "GET", "", 400, "'filter'"},
+	{"/rest/User?filter=%7B%22Op%22%3A%22unknown%22%2C%22Attr%22%3A%22title%22%7D", "GET", "", 400, "'filter'"},
+	{"/rest/User?filter=title+ilk", "GET", "", 400, "'filter'"},
+	{"/rest/User?sort=similarity(lastname", "GET", "", 400, "'sort'"},
+	{"/rest/User?debug=maybe", "GET", "", 400, "'debug'"},
+	{"/rest/Book?bbox=2.2,48.8,2.5,48.9", "GET", "", 400, "'bbox'"},
+	{"/rest/Place?bbox=2.2,48.8,2.5", "GET", "", 400, "'bbox'"},
+	{"/rest/Book", "POST", "{\"Title\":\"a too long title\"}", 413, "16 bytes"},
+	{"/rest/Place/tiles/2/4/1.mvt", "GET", "", 400, "'tile'"},
+	{"/rest/Place?maxDistance=100", "GET", "", 400, "'maxDistance'"},
+	{"/rest/Place?crs=WGS84", "GET", "", 400, "'crs'"},
+	{"/rest/Place?cluster=hexagon", "GET", "", 400, "'cluster'"},
+	{"/rest/Place?cluster=kmeans&k=0", "GET", "", 400, "'k'"},
+	{"/rest/Place?cluster=grid&cellSize=1&aggregates=median(id)", "GET", "", 400, "'aggregates'"},
+	{"/rest/Place/tiles/31/0/0.mvt", "GET", "", 400, "'tile'"},
+	{"/rest/Book/_copy?format=xml", "GET", "", 400, "'format'"},
+}
+
+func TestRequestDecoderError(t *testing.T) {
+	ts := httptest.NewServer(decodeHandler("/rest/"))
+	defer ts.Close()
+
+	for _, rt := range requestDecoderErrorTests {
+		req, err := http.NewRequest(rt.method, ts.URL+rt.uri, bytes.NewBufferString(rt.body))
+		assert.Nil(t, err)
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		assert.Nil(t, err)
+		err = res.Body.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, rt.code, res.StatusCode)
+		assert.Contains(t, string(body), rt.expected)
+	}
+}
+
+func TestDeprecatedRequestDecoder(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	config.AddResource(pgrest.NewResource("Book", (*Book)(nil), pgrest.All))
+
+	restQuery := pgrest.RequestDecoder(httptest.NewRequest("GET", "/rest/Book?limit=5", nil), config)
+	assert.NotNil(t, restQuery)
+	assert.Equal(t, 5, restQuery.Limit)
+
+	assert.Nil(t, pgrest.RequestDecoder(httptest.NewRequest("GET", "/rest/Book?limit=ten", nil), config))
+}
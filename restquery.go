@@ -1,9 +1,14 @@
 package pgrest
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 // RestQuery structure
@@ -21,8 +26,15 @@ type RestQuery struct {
 	Relations   []*Relation
 	Sorts       []*Sort
 	Filter      *Filter
+	Threshold   float64
+	Tile        *Tile
+	Crs         int
+	Cluster     *Cluster
+	Copy        CopyFormat
 	SearchPath  string
 	Debug       bool
+	// lines are start lines of decoded bulk content rows
+	lines []int
 }
 
 func (q *RestQuery) String() string {
@@ -38,12 +50,32 @@ func (q *RestQuery) String() string {
 	} else {
 		str = fmt.Sprintf("action=%v resource=%v key=%v content-type=%v content=%v", q.Action, q.Resource, q.Key, q.ContentType, q.Content)
 	}
+	if q.Tile != nil {
+		str += fmt.Sprintf(" tile=%v", q.Tile)
+	}
+	if q.Cluster != nil {
+		str += fmt.Sprintf(" cluster=%v", q.Cluster)
+	}
+	if q.Copy != "" {
+		str += fmt.Sprintf(" copy=%v", q.Copy)
+	}
+	if q.Crs != 0 {
+		str += fmt.Sprintf(" crs=%v", q.Crs)
+	}
 	if q.SearchPath != "" {
 		str += fmt.Sprintf(" search_path=%v", q.SearchPath)
 	}
 	return str
 }
 
+// inputSRID gets SRID of spatial values without SRID: requested crs or DefaultSRID
+func (q *RestQuery) inputSRID() int {
+	if q.Crs != 0 {
+		return q.Crs
+	}
+	return DefaultSRID
+}
+
 // Field structure
 type Field struct {
 	Name string
@@ -64,15 +96,25 @@ func (r *Relation) String() string {
 
 // Sort structure
 type Sort struct {
-	Name string
-	Asc  bool
+	Name  string      // attribute name
+	Asc   bool        // ascending order
+	Func  SortFunc    // optional sort function ('similarity', ...)
+	Value interface{} // sort function value
+	Alias string      // optional virtual field receiving sort function score
 }
 
 func (s *Sort) String() string {
+	expr := s.Name
+	if s.Func != "" {
+		expr = fmt.Sprintf("%v(%v, %v)", s.Func, s.Name, s.Value)
+		if s.Alias != "" {
+			expr += " as " + s.Alias
+		}
+	}
 	if s.Asc {
-		return fmt.Sprintf("asc(%v)", s.Name)
+		return fmt.Sprintf("asc(%v)", expr)
 	}
-	return fmt.Sprintf("desc(%v)", s.Name)
+	return fmt.Sprintf("desc(%v)", expr)
 }
 
 // Filter structure
@@ -83,15 +125,104 @@ type Filter struct {
 	Filters []*Filter   // sub filters for 'and' and 'or' operations
 }
 
+// Validate checks filter operations and attributes, empty filter is valid
+func (f *Filter) Validate() error {
+	if f.Op == "" && f.Attr == "" && len(f.Filters) == 0 {
+		return nil
+	}
+	return f.validate()
+}
+
+func (f *Filter) validate() error {
+	if !f.Op.valid() {
+		return fmt.Errorf("unknown operation '%v'", f.Op)
+	}
+	if f.Op == And || f.Op == Or {
+		if len(f.Filters) == 0 {
+			return fmt.Errorf("operation '%v' without sub filters", f.Op)
+		}
+		for _, filter := range f.Filters {
+			if filter == nil {
+				return fmt.Errorf("operation '%v' with null sub filter", f.Op)
+			}
+			if err := filter.validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if f.Attr == "" {
+		return fmt.Errorf("operation '%v' without attribute", f.Op)
+	}
+	return nil
+}
+
+// String formats filter with the syntax accepted by ParseFilter
 func (f *Filter) String() string {
 	if f.Op == And || f.Op == Or {
-		var sb strings.Builder
+		strs := make([]string, 0, len(f.Filters))
 		for _, filter := range f.Filters {
-			sb.WriteRune(' ')
-			sb.WriteString(filter.String())
-			sb.WriteRune(' ')
+			if filter.Op == And || filter.Op == Or {
+				// Always parenthesize sub-groups so that parsing the string gives the same tree
+				strs = append(strs, "("+filter.String()+")")
+			} else {
+				strs = append(strs, filter.String())
+			}
+		}
+		return strings.Join(strs, " "+f.Op.String()+" ")
+	}
+	if f.Op == "" {
+		return ""
+	}
+	if f.Op == Null || f.Op == Nnull {
+		return fmt.Sprintf("%v %v", formatFilterAttr(f.Attr), f.Op)
+	}
+	return fmt.Sprintf("%v %v %v", formatFilterAttr(f.Attr), f.Op, formatFilterValue(f.Value))
+}
+
+func formatFilterAttr(attr string) string {
+	for i, r := range attr {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && (r == '.' || unicode.IsDigit(r)))) {
+			return "\"" + strings.Replace(attr, "\"", "\"\"", -1) + "\""
+		}
+	}
+	return attr
+}
+
+func formatFilterValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case time.Time:
+		return "'" + v.Format(time.RFC3339Nano) + "'"
+	case *Envelope:
+		return formatFilterValue([]interface{}{v.MinX, v.MinY, v.MaxX, v.MaxY, v.SRID})
+	case *GeometryDistance:
+		return formatFilterValue([]interface{}{v.Geometry, v.Distance})
+	case map[string]interface{}:
+		data, _ := json.Marshal(v)
+		return formatFilterValue(string(data))
+	case fmt.Stringer:
+		return "'" + strings.Replace(v.String(), "'", "''", -1) + "'"
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		strs := make([]string, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			strs[i] = formatFilterValue(rv.Index(i).Interface())
 		}
-		return fmt.Sprintf("%v (%v)", f.Op, sb)
+		return "(" + strings.Join(strs, ", ") + ")"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(value)
 	}
-	return fmt.Sprintf("%v %v %v", f.Attr, f.Op, f.Value)
+	return formatFilterValue(fmt.Sprint(value))
 }
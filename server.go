@@ -1,13 +1,9 @@
 package pgrest
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"regexp"
-
-	"github.com/vmihailenco/msgpack/v5"
 )
 
 // Server structure
@@ -30,37 +26,44 @@ func (s *Server) SetNextHandler(next http.Handler) {
 
 // ServeHTTP serves rest request
 func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	restQuery := RequestDecoder(request, s.Config())
-	if restQuery != nil {
+	restQuery, err := DecodeRequest(request, s.Config())
+	if err != nil {
+		s.writeError(writer, err, http.StatusBadRequest)
+	} else if restQuery != nil && restQuery.Copy != "" && restQuery.Action == Get {
+		s.writeStream(writer, restQuery, restQuery.Copy.ContentType(), func(w io.Writer) error {
+			return s.CopyTo(restQuery, w)
+		})
+	} else if restQuery != nil && restQuery.Copy != "" {
+		res, err := s.CopyFrom(restQuery)
+		if err != nil {
+			s.writeError(writer, err, http.StatusInternalServerError)
+		} else if serialized, contentType, err := s.Serialize(restQuery, res); err != nil {
+			s.writeError(writer, err, http.StatusInternalServerError)
+		} else {
+			s.writeHeader(writer, restQuery, contentType)
+			writer.Write(serialized)
+		}
+	} else if restQuery != nil && s.streamed(restQuery) {
+		s.writeStream(writer, restQuery, NDJSONCodec{}.MediaTypes()[0], func(w io.Writer) error {
+			return s.Stream(restQuery, w)
+		})
+	} else if restQuery != nil {
 		res, err := s.Execute(restQuery)
 		if err != nil {
-			s.Config().ErrorLogger().Printf("%v\n", err.Error())
-			if cerr, ok := err.(*Error); ok {
-				http.Error(writer, cerr.Error(), cerr.StatusCode())
-			}
+			s.writeError(writer, err, http.StatusInternalServerError)
 		} else if res == nil {
 			s.Config().ErrorLogger().Printf("Resource not found\n")
 			http.Error(writer, "Resource not found", http.StatusNotFound)
+		} else if encoder, contentType := s.streamEncoder(restQuery); encoder != nil {
+			s.writeStream(writer, restQuery, contentType, func(w io.Writer) error {
+				return encoder.EncodeTo(w, restQuery, s.Config().GetResource(restQuery.Resource), res)
+			})
 		} else {
 			serialized, contentType, err := s.Serialize(restQuery, res)
 			if err != nil {
-				s.Config().ErrorLogger().Printf("%v\n", err.Error())
-				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				s.writeError(writer, err, http.StatusInternalServerError)
 			} else {
-				if restQuery.Action == Get {
-					writer.WriteHeader(http.StatusOK)
-				} else if restQuery.Action == Post {
-					writer.WriteHeader(http.StatusCreated)
-				} else if restQuery.Action == Put {
-					writer.WriteHeader(http.StatusOK)
-				} else if restQuery.Action == Patch {
-					writer.WriteHeader(http.StatusOK)
-				} else if restQuery.Action == Delete {
-					writer.WriteHeader(http.StatusNoContent)
-				} else {
-					writer.WriteHeader(http.StatusOK)
-				}
-				writer.Header().Add("Content-Type", contentType)
+				s.writeHeader(writer, restQuery, contentType)
 				writer.Write(serialized)
 			}
 		}
@@ -74,25 +77,111 @@ func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// writeHeader writes headers and status code of action
+func (s *Server) writeHeader(writer http.ResponseWriter, restQuery *RestQuery, contentType string) {
+	// Headers must be set before status code is written
+	writer.Header().Add("Content-Type", contentType)
+	if restQuery.Crs != 0 && restQuery.Tile == nil {
+		writer.Header().Add("Content-Crs", "<"+CrsURI(restQuery.Crs)+">")
+	}
+	if restQuery.Action == Get {
+		writer.WriteHeader(http.StatusOK)
+	} else if restQuery.Action == Post {
+		writer.WriteHeader(http.StatusCreated)
+	} else if restQuery.Action == Put {
+		writer.WriteHeader(http.StatusOK)
+	} else if restQuery.Action == Patch {
+		writer.WriteHeader(http.StatusOK)
+	} else if restQuery.Action == Delete {
+		writer.WriteHeader(http.StatusNoContent)
+	} else {
+		writer.WriteHeader(http.StatusOK)
+	}
+}
+
+// streamed checks that rest query is a get slice query accepting NDJSON
+func (s *Server) streamed(restQuery *RestQuery) bool {
+	return restQuery.Action == Get && restQuery.Key == "" && restQuery.Tile == nil && restQuery.Cluster == nil && ndjsonRegexp.MatchString(restQuery.Accept)
+}
+
+// writeStream writes response streamed by fn, headers are written before first write
+// and errors are written only if nothing has been written yet
+func (s *Server) writeStream(writer http.ResponseWriter, restQuery *RestQuery, contentType string, fn func(w io.Writer) error) {
+	w := &streamWriter{writer: writer, writeHeader: func() { s.writeHeader(writer, restQuery, contentType) }}
+	err := fn(w)
+	if err != nil && !w.started {
+		s.writeError(writer, err, http.StatusInternalServerError)
+	} else if err != nil {
+		// Status code is already written
+		s.Config().ErrorLogger().Printf("%v\n", err.Error())
+	} else {
+		w.start()
+	}
+}
+
+// streamEncoder gets stream encoder and content type of accept, nil if negotiated codec doesn't stream
+func (s *Server) streamEncoder(restQuery *RestQuery) (StreamEncoder, string) {
+	if restQuery.Tile != nil {
+		return nil, ""
+	}
+	codec, _, err := s.Config().negotiateCodec(restQuery.Accept, s.Config().GetResource(restQuery.Resource))
+	if err != nil {
+		return nil, ""
+	}
+	if encoder, ok := codec.(StreamEncoder); ok {
+		return encoder, codec.MediaTypes()[0]
+	}
+	return nil, ""
+}
+
+// writeError logs and writes error with its status code, defaultCode if error isn't an Error
+func (e *Engine) writeError(writer http.ResponseWriter, err error, defaultCode int) {
+	e.Config().ErrorLogger().Printf("%v\n", err.Error())
+	if cerr, ok := err.(*Error); ok {
+		http.Error(writer, cerr.Error(), cerr.StatusCode())
+	} else {
+		http.Error(writer, err.Error(), defaultCode)
+	}
+}
+
 // Serialize serializes data into entity
 func (s *Server) Serialize(restQuery *RestQuery, entity interface{}) ([]byte, string, error) {
-	var contentType string
-	var data []byte
-	var err error
-	if regexp.MustCompile("[+-/]json($|[+-;])").MatchString(restQuery.Accept) {
-		data, err = json.Marshal(entity)
-		contentType = "application/json; charset=utf-8"
-	} else if regexp.MustCompile("[+-/]msgpack($|[+-;])").MatchString(restQuery.Accept) {
-		var buf bytes.Buffer
-		encoder := msgpack.NewEncoder(&buf)
-		encoder.SetCustomStructTag("json")
-		encoder.UseCompactInts(true)
-		err = encoder.Encode(entity)
-		data = buf.Bytes()
-		contentType = "application/x-msgpack"
-	} else {
-		err = NewErrorBadRequest(fmt.Sprintf("Unknown accept '%v'", restQuery.Accept))
-		contentType = "plain/text; charset=utf-8"
+	if tile, ok := entity.(VectorTile); ok {
+		return tile, "application/vnd.mapbox-vector-tile", nil
+	}
+	codec, _, err := s.Config().negotiateCodec(restQuery.Accept, s.Config().GetResource(restQuery.Resource))
+	if err != nil {
+		return nil, "plain/text; charset=utf-8", err
+	}
+	data, err := codec.Encode(restQuery, s.Config().GetResource(restQuery.Resource), entity)
+	if err == ErrUnsupported {
+		return nil, "plain/text; charset=utf-8", NewErrorNotAcceptable(fmt.Sprintf("accept '%v' can't be encoded", restQuery.Accept))
+	} else if err != nil {
+		return nil, "plain/text; charset=utf-8", err
+	}
+	return data, codec.MediaTypes()[0], nil
+}
+
+// streamWriter writes headers and status code before first write of streamed response
+type streamWriter struct {
+	writer      http.ResponseWriter
+	writeHeader func()
+	started     bool
+}
+
+func (w *streamWriter) start() {
+	if !w.started {
+		w.writeHeader()
+		w.started = true
+	}
+}
+
+// Write implements io.Writer
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.start()
+	n, err := w.writer.Write(p)
+	if flusher, ok := w.writer.(http.Flusher); ok {
+		flusher.Flush()
 	}
-	return data, contentType, err
+	return n, err
 }
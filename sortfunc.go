@@ -0,0 +1,25 @@
+package pgrest
+
+// SortFunc sort function type
+type SortFunc string
+
+const (
+	// Similarity sort function for attribute (? <-> ?), closest first, needs pg_trgm extension
+	Similarity SortFunc = "similarity"
+	// WordSimilarity sort function for attribute (? <<-> ?), closest first, needs pg_trgm extension
+	WordSimilarity SortFunc = "word_similarity"
+	// Distance sort function for geometry attribute (? <-> ?), nearest first, needs postgis extension
+	Distance SortFunc = "distance"
+)
+
+func (f SortFunc) String() string {
+	return string(f)
+}
+
+func (f SortFunc) valid() bool {
+	switch f {
+	case Similarity, WordSimilarity, Distance:
+		return true
+	}
+	return false
+}
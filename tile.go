@@ -0,0 +1,119 @@
+package pgrest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aptogeo/pgrest/transactional"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+const (
+	// TileExtent is vector tile extent in tile coordinate units
+	TileExtent = 4096
+	// TileBuffer is vector tile buffer in tile coordinate units
+	TileBuffer = 64
+	// MaxTileZoom is maximum zoom level of vector tiles
+	MaxTileZoom = 30
+)
+
+// Tile structure, vector tile coordinates
+type Tile struct {
+	Z int
+	X int
+	Y int
+}
+
+func (t *Tile) String() string {
+	return fmt.Sprintf("%v/%v/%v", t.Z, t.X, t.Y)
+}
+
+// validate checks zoom level and tile coordinates
+func (t *Tile) validate() error {
+	if t.Z < 0 || t.Z > MaxTileZoom {
+		return fmt.Errorf("zoom level must be between 0 and %v", MaxTileZoom)
+	}
+	if t.X < 0 || t.Y < 0 || t.X >= 1<<uint(t.Z) || t.Y >= 1<<uint(t.Z) {
+		return fmt.Errorf("tile coordinates out of zoom level %v", t.Z)
+	}
+	return nil
+}
+
+// VectorTile is Mapbox Vector Tile data
+type VectorTile []byte
+
+// TileExecFunc gets vector tile execution function
+func (e *Executor) TileExecFunc() transactional.ExecFunc {
+	return func(ctx context.Context, tx *pg.Tx) error {
+		tile := e.restQuery.Tile
+		if e.resource == nil || e.resource.GeometryField() == "" {
+			return NewErrorBadRequest(fmt.Sprintf("resource '%v' without geometry field", e.restQuery.Resource))
+		}
+		if tile.Z < e.resource.MinZoom() || (e.resource.MaxZoom() > 0 && tile.Z > e.resource.MaxZoom()) {
+			return &Error{Message: fmt.Sprintf("tile %v out of zoom levels of resource '%v'", tile, e.restQuery.Resource), Code: 404}
+		}
+		if err := tile.validate(); err != nil {
+			return NewErrorParam("tile", err)
+		}
+		if err := checkExtension(ctx, tx, "postgis"); err != nil {
+			return err
+		}
+		table := orm.GetTable(e.resource.ResourceType())
+		geometryField := e.resource.GeometryField()
+		srid, err := e.resource.nativeSRID(ctx, tx, e.restQuery.SearchPath)
+		if err != nil {
+			return NewErrorFromCause(e.restQuery, err)
+		}
+		if srid > 0 {
+			transformSpatialValues(e.restQuery.Filter, nil, srid)
+		}
+		envelope := fmt.Sprintf("ST_TileEnvelope(%d, %d, %d)", tile.Z, tile.X, tile.Y)
+		geometryExpr := fmt.Sprintf("ST_AsMVTGeom(ST_Transform(?, 3857), %v, %d, %d, true)", envelope, TileExtent, TileBuffer)
+		if e.resource.TileTolerance() > 0 {
+			geometryExpr = fmt.Sprintf("ST_Simplify(%v, %v, true)", geometryExpr, e.resource.TileTolerance())
+		}
+		fields := e.restQuery.Fields
+		if len(fields) > 0 {
+			fields = append([]*Field{{Name: geometryField}}, fields...)
+		}
+		q := tx.ModelContext(ctx, e.entity)
+		q = addQueryColumns(q, table, fields, nil, geometryField, geometryExpr)
+		if srid > 0 {
+			q = q.Where("? && ST_Transform("+envelope+", ?)", types.Ident(geometryField), srid)
+		} else {
+			q = q.Where("ST_Transform(?, 3857) && "+envelope, types.Ident(geometryField))
+		}
+		if q, err = addQueryFilter(q, e.restQuery.Filter, And); err != nil {
+			return err
+		}
+		mvt := "ST_AsMVT(mvtgeom.*, ?, ?, ?)"
+		params := []interface{}{e.restQuery.Resource, TileExtent, geometryField}
+		if len(table.PKs) == 1 && strings.HasPrefix(table.PKs[0].Type.Kind().String(), "int") && tileHasField(table, fields, table.PKs[0]) {
+			mvt = "ST_AsMVT(mvtgeom.*, ?, ?, ?, ?)"
+			params = append(params, table.PKs[0].SQLName)
+		}
+		var data []byte
+		w := q.WrapWith("mvtgeom").Table("mvtgeom").ColumnExpr(mvt, params...)
+		if err = w.Select(pg.Scan(&data)); err != nil {
+			return NewErrorFromCause(e.restQuery, err)
+		}
+		e.vectorTile = VectorTile(data)
+		return nil
+	}
+}
+
+// tileHasField checks that field is selected
+func tileHasField(table *orm.Table, fields []*Field, field *orm.Field) bool {
+	if len(fields) == 0 {
+		return true
+	}
+	for _, f := range fields {
+		if f.Name == "*" || findField(table, f.Name) == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package transactional
+
+import (
+	"context"
+	"sync"
+)
+
+// callbacks structure, callbacks registered in transaction or savepoint
+type callbacks struct {
+	mutex         sync.Mutex
+	afterCommit   []func()
+	afterRollback []func()
+}
+
+// AfterCommit registers callback executed once outermost transaction is committed, callback is
+// discarded if transaction or enclosing savepoint is rolled back and executed immediately outside
+// transaction started by Execute or Middleware
+func AfterCommit(ctx context.Context, callback func()) {
+	if c := callbacksFromContext(ctx); c != nil {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.afterCommit = append(c.afterCommit, callback)
+	} else {
+		callback()
+	}
+}
+
+// AfterRollback registers callback executed once outermost transaction is rolled back, callback is
+// discarded if transaction is committed or enclosing savepoint is rolled back and executed immediately
+// outside transaction started by Execute or Middleware
+func AfterRollback(ctx context.Context, callback func()) {
+	if c := callbacksFromContext(ctx); c != nil {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.afterRollback = append(c.afterRollback, callback)
+	} else {
+		callback()
+	}
+}
+
+// release moves callbacks of released savepoint to callbacks of enclosing transaction or savepoint
+func (c *callbacks) release(parent *callbacks) {
+	c.mutex.Lock()
+	afterCommit, afterRollback := c.afterCommit, c.afterRollback
+	c.afterCommit, c.afterRollback = nil, nil
+	c.mutex.Unlock()
+	parent.mutex.Lock()
+	defer parent.mutex.Unlock()
+	parent.afterCommit = append(parent.afterCommit, afterCommit...)
+	parent.afterRollback = append(parent.afterRollback, afterRollback...)
+}
+
+// run executes after commit or after rollback callbacks, other ones are discarded
+func (c *callbacks) run(committed bool) {
+	c.mutex.Lock()
+	run := c.afterRollback
+	if committed {
+		run = c.afterCommit
+	}
+	c.afterCommit, c.afterRollback = nil, nil
+	c.mutex.Unlock()
+	for _, callback := range run {
+		callback()
+	}
+}
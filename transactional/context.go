@@ -47,3 +47,31 @@ func TxFromContext(ctx context.Context) *pg.Tx {
 func ContextWithTx(ctx context.Context, tx *pg.Tx) context.Context {
 	return context.WithValue(ctx, contextKey("tx"), tx)
 }
+
+// optionsFromContext retrives options of Tx from context, default options if unknown
+func optionsFromContext(ctx context.Context) Options {
+	v := ValueFromContext(ctx, "txoptions")
+	if v == nil {
+		return Options{}
+	}
+	return v.(Options)
+}
+
+// contextWithOptions sets options of Tx to context request
+func contextWithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, contextKey("txoptions"), opts)
+}
+
+// callbacksFromContext retrives callbacks of Tx or savepoint from context
+func callbacksFromContext(ctx context.Context) *callbacks {
+	v := ValueFromContext(ctx, "txcallbacks")
+	if v == nil {
+		return nil
+	}
+	return v.(*callbacks)
+}
+
+// contextWithCallbacks sets callbacks of Tx or savepoint to context request
+func contextWithCallbacks(ctx context.Context, c *callbacks) context.Context {
+	return context.WithValue(ctx, contextKey("txcallbacks"), c)
+}
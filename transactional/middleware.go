@@ -0,0 +1,135 @@
+package transactional
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// MiddlewareOptions structure
+type MiddlewareOptions struct {
+	// Skip returns true for requests executed without request transaction (health checks, static files, ...)
+	Skip func(request *http.Request) bool
+	// Options gets options of request transaction, default options if nil
+	Options func(request *http.Request) Options
+	// ErrorLogger logs commit failures, standard logger if nil
+	ErrorLogger *log.Logger
+}
+
+// bufferedWriter structure, holds back response written by handler until transaction ends,
+// response is passed through from first flush
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	sent   bool
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write implements http.ResponseWriter
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.sent {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+// Flush implements http.Flusher, held back response is sent and following writes are passed through
+func (w *bufferedWriter) Flush() {
+	w.send()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// send writes held back response once
+func (w *bufferedWriter) send() {
+	if w.sent {
+		return
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.sent = true
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.body.Bytes())
+	w.body.Reset()
+}
+
+// Middleware wraps handler with one transaction per request, set in request context: transaction
+// is committed when status is 2xx or 3xx, rolled back otherwise or on panic. Response is held back
+// until transaction ends so that commit failures are reported with 500 status, except streamed
+// responses flushed by handler: they are passed through and commit failures are only logged
+func Middleware(db *pg.DB, opts *MiddlewareOptions) func(http.Handler) http.Handler {
+	if opts == nil {
+		opts = &MiddlewareOptions{}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if opts.Skip != nil && opts.Skip(request) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			var txOpts Options
+			if opts.Options != nil {
+				txOpts = opts.Options(request)
+			}
+			tx, err := begin(request.Context(), db, txOpts)
+			if err != nil {
+				http.Error(writer, "Transaction can't be started", http.StatusServiceUnavailable)
+				return
+			}
+			txCallbacks := &callbacks{}
+			ended := false
+			defer func() {
+				if !ended {
+					tx.Rollback()
+					txCallbacks.run(false)
+				}
+			}()
+			ctx := contextWithCallbacks(contextWithOptions(ContextWithTx(ContextWithDb(request.Context(), db), tx), txOpts), txCallbacks)
+			buffered := &bufferedWriter{ResponseWriter: writer}
+			next.ServeHTTP(buffered, request.WithContext(ctx))
+			if buffered.status != 0 && (buffered.status < 200 || buffered.status >= 400) {
+				tx.Rollback()
+				ended = true
+				txCallbacks.run(false)
+				buffered.send()
+				return
+			}
+			if err := tx.Commit(); err != nil {
+				if opts.ErrorLogger != nil {
+					opts.ErrorLogger.Printf("Request transaction can't be committed: %v\n", err)
+				} else {
+					log.Printf("Request transaction can't be committed: %v\n", err)
+				}
+				ended = true
+				txCallbacks.run(false)
+				if buffered.sent {
+					// Streamed response is already sent
+					return
+				}
+				// Headers of held back response are dropped
+				for key := range writer.Header() {
+					writer.Header().Del(key)
+				}
+				http.Error(writer, "Transaction can't be committed", http.StatusInternalServerError)
+				return
+			}
+			ended = true
+			txCallbacks.run(true)
+			buffered.send()
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package transactional_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aptogeo/pgrest/transactional"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	db := initTests(t)
+	var status int
+	handler := transactional.Middleware(db, nil)(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.NotNil(t, transactional.TxFromContext(request.Context()))
+		err := transactional.Execute(request.Context(), func(ctx context.Context, tx *pg.Tx) error {
+			_, err := tx.ModelContext(ctx, &Todo{Text: "ok"}).Insert()
+			return err
+		})
+		assert.Nil(t, err)
+		if status == 0 {
+			panic("ko")
+		}
+		writer.WriteHeader(status)
+	}))
+
+	for _, status = range []int{http.StatusOK, http.StatusSeeOther, http.StatusBadRequest, http.StatusInternalServerError} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	}
+	count, err := db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	status = 0
+	assert.Panics(t, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	})
+	count, err = db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// Response is held back until commit
+	deferred := transactional.Middleware(db, nil)(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		tx := transactional.TxFromContext(request.Context())
+		_, err := tx.Exec("CREATE TEMP TABLE deferred_check (id int UNIQUE DEFERRABLE INITIALLY DEFERRED) ON COMMIT DROP")
+		assert.Nil(t, err)
+		// Commit fails on deferred constraint
+		_, err = tx.Exec("INSERT INTO deferred_check VALUES (1), (1)")
+		assert.Nil(t, err)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusCreated)
+		writer.Write([]byte("{}"))
+	}))
+	recorder := httptest.NewRecorder()
+	deferred.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.NotEqual(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.NotEqual(t, "{}", recorder.Body.String())
+
+	// Flushed response is streamed, not held back
+	recorder = httptest.NewRecorder()
+	streamed := transactional.Middleware(db, nil)(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/x-ndjson")
+		for i := 0; i < 3; i++ {
+			writer.Write([]byte("{}\n"))
+			writer.(http.Flusher).Flush()
+			assert.Equal(t, i+1, strings.Count(recorder.Body.String(), "\n"))
+		}
+		assert.True(t, recorder.Flushed)
+	}))
+	streamed.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/x-ndjson", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "{}\n{}\n{}\n", recorder.Body.String())
+
+	skipped := transactional.Middleware(db, &transactional.MiddlewareOptions{Skip: func(request *http.Request) bool { return true }})
+	skipped(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Nil(t, transactional.TxFromContext(request.Context()))
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,74 @@
+package transactional
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// RetryPolicy structure, retry of transactions failing with serialization failure (40001)
+// or deadlock (40P01)
+type RetryPolicy struct {
+	Attempts   int                          // maximum number of attempts, including first one
+	Backoff    time.Duration                // backoff before first retry, doubled on each retry
+	MaxBackoff time.Duration                // maximum backoff, no maximum if 0
+	OnRetry    func(attempt int, err error) // called before retry with number of failed attempts and error
+	Retryable  func(err error) bool         // retryable errors, IsRetryable if nil
+}
+
+// NewRetryPolicy constructs RetryPolicy
+func NewRetryPolicy(attempts int, backoff time.Duration) *RetryPolicy {
+	return &RetryPolicy{Attempts: attempts, Backoff: backoff}
+}
+
+// IsRetryable checks that error is a serialization failure or a deadlock
+func IsRetryable(err error) bool {
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		code := pgErr.Field('C')
+		return code == "40001" || code == "40P01"
+	}
+	return false
+}
+
+// backoff gets jittered backoff after failed attempt: random duration between half and full backoff
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// retry executes ExecFunc in new transaction until it succeeds, fails with non retryable error
+// or attempts are exhausted
+func retry(ctx context.Context, opts Options, execFunc ExecFunc) error {
+	policy := opts.Retry
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	for attempt := 1; ; attempt++ {
+		err := executeOnce(ctx, opts, execFunc)
+		if err == nil || attempt >= policy.Attempts || !retryable(err) {
+			return err
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(policy.backoff(attempt)):
+		}
+	}
+}
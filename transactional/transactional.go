@@ -3,14 +3,16 @@ package transactional
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-pg/pg/v10"
 )
 
-// ExecFunc definition
+// ExecFunc definition, tx is nil with NotSupported and Never propagations
 type ExecFunc func(ctx context.Context, tx *pg.Tx) error
 
 // Propagation type
@@ -25,8 +27,93 @@ const (
 
 	// Savepoint supports a current transaction, creates a new one if none exists, creates savepoint and never return propagation error
 	Savepoint Propagation = "Savepoint"
+
+	// RequiresNew creates a new transaction with its own connection, current transaction is left untouched
+	RequiresNew Propagation = "RequiresNew"
+
+	// NotSupported executes without transaction (nil pg.Tx), current transaction is left untouched
+	NotSupported Propagation = "NotSupported"
+
+	// Never executes without transaction (nil pg.Tx), return an exception if a current transaction exists
+	Never Propagation = "Never"
+
+	// Nested supports a current transaction, creates a new one if none exists, creates savepoint and return propagation error
+	Nested Propagation = "Nested"
 )
 
+// Isolation type, transaction isolation level
+type Isolation string
+
+const (
+	// DefaultIsolation uses isolation level of database session
+	DefaultIsolation Isolation = ""
+
+	// ReadCommitted isolation level
+	ReadCommitted Isolation = "READ COMMITTED"
+
+	// RepeatableRead isolation level
+	RepeatableRead Isolation = "REPEATABLE READ"
+
+	// Serializable isolation level
+	Serializable Isolation = "SERIALIZABLE"
+)
+
+// Options structure, transaction options
+type Options struct {
+	Propagation Propagation // Current if empty
+	Isolation   Isolation
+	ReadOnly    bool
+	Deferrable  bool         // only used by serializable read-only transactions
+	Retry       *RetryPolicy // retry of outermost transaction, no retry if nil
+}
+
+// ErrConflictingOptions is returned when options can't be satisfied by current transaction
+var ErrConflictingOptions = errors.New("conflicting transaction options")
+
+// conflicts checks that current transaction started with options satisfies requested options
+func (o Options) conflicts(current Options) error {
+	if o.Isolation != DefaultIsolation && o.Isolation != current.Isolation {
+		return fmt.Errorf("%w: isolation level '%v' requested in transaction with isolation level '%v'", ErrConflictingOptions, o.Isolation, current.Isolation)
+	}
+	if o.ReadOnly && !current.ReadOnly {
+		return fmt.Errorf("%w: read-only requested in read-write transaction", ErrConflictingOptions)
+	}
+	if o.Deferrable && !current.Deferrable {
+		return fmt.Errorf("%w: deferrable requested in not deferrable transaction", ErrConflictingOptions)
+	}
+	return nil
+}
+
+// transactionModes gets SET TRANSACTION modes, empty for default options
+func (o Options) transactionModes() string {
+	modes := make([]string, 0, 3)
+	if o.Isolation != DefaultIsolation {
+		modes = append(modes, "ISOLATION LEVEL "+string(o.Isolation))
+	}
+	if o.ReadOnly {
+		modes = append(modes, "READ ONLY")
+	}
+	if o.Deferrable {
+		modes = append(modes, "DEFERRABLE")
+	}
+	return strings.Join(modes, ", ")
+}
+
+// begin begins transaction with options
+func begin(ctx context.Context, db *pg.DB, opts Options) (*pg.Tx, error) {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if modes := opts.transactionModes(); modes != "" {
+		if _, err = tx.ExecContext(ctx, "SET TRANSACTION "+modes); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
 // PropagationError struct
 type propagationError struct {
 	Cause       error
@@ -43,31 +130,75 @@ func (e propagationError) Error() string {
 	return e.Cause.Error()
 }
 
+// Unwrap gets cause
+func (e propagationError) Unwrap() error {
+	return e.Cause
+}
+
 // Execute executes ExecFunc in transaction
 func Execute(ctx context.Context, execFunc ExecFunc) error {
-	return execute(ctx, Current, execFunc)
+	return execute(ctx, Options{Propagation: Current}, execFunc)
 }
 
 // ExecuteWithPropagation executes ExecFunc in transaction with specific propagation
 func ExecuteWithPropagation(ctx context.Context, propagation Propagation, execFunc ExecFunc) error {
-	return execute(ctx, propagation, execFunc)
+	return execute(ctx, Options{Propagation: propagation}, execFunc)
+}
+
+// ExecuteWithOptions executes ExecFunc in transaction with specific options, options of
+// a current transaction must satisfy requested options
+func ExecuteWithOptions(ctx context.Context, opts Options, execFunc ExecFunc) error {
+	if opts.Propagation == "" {
+		opts.Propagation = Current
+	}
+	return execute(ctx, opts, execFunc)
+}
+
+func execute(ctx context.Context, opts Options, execFunc ExecFunc) error {
+	if opts.Retry != nil && ((opts.Propagation == Current && TxFromContext(ctx) == nil) || opts.Propagation == RequiresNew) {
+		// Only outermost transaction is retried
+		return retry(ctx, opts, execFunc)
+	}
+	return executeOnce(ctx, opts, execFunc)
 }
 
-func execute(ctx context.Context, propagation Propagation, execFunc ExecFunc) error {
+func executeOnce(ctx context.Context, opts Options, execFunc ExecFunc) (rerr error) {
+	propagation := opts.Propagation
 	var err error
 	var localtx *pg.Tx
+	var localCallbacks *callbacks
 	var savepoint string
 	defer func() {
 		if localtx != nil {
+			committed := false
 			if err == nil || propagation == Savepoint {
-				localtx.Commit()
+				// Serialization failures may be reported on commit
+				cerr := localtx.Commit()
+				if cerr != nil && rerr == nil && propagation != Savepoint {
+					rerr = newPropagationError(cerr, propagation)
+				}
+				committed = cerr == nil
 			} else {
 				localtx.Rollback()
 			}
+			localCallbacks.run(committed)
 		}
 	}()
 	db := DbFromContext(ctx)
 	tx := TxFromContext(ctx)
+	if propagation == NotSupported || propagation == Never {
+		if propagation == Never && tx != nil {
+			return newPropagationError(errors.New("pg.Tx found in context with Never propagation"), propagation)
+		}
+		if err = execFunc(contextWithCallbacks(contextWithOptions(ContextWithTx(ctx, nil), Options{}), nil), nil); err != nil {
+			return newPropagationError(err, propagation)
+		}
+		return nil
+	}
+	if propagation == RequiresNew {
+		// Current transaction is suspended
+		tx = nil
+	}
 	if tx == nil {
 		if propagation == Mandatory {
 			return newPropagationError(errors.New("No pg.Tx found in context with Mandatory propagation"), propagation)
@@ -75,16 +206,28 @@ func execute(ctx context.Context, propagation Propagation, execFunc ExecFunc) er
 		if db == nil {
 			return newPropagationError(errors.New("No pg.DB found in context"), propagation)
 		}
-		tx, err = db.Begin()
+		tx, err = begin(ctx, db, opts)
 		if err != nil {
 			return newPropagationError(err, propagation)
 		}
 		localtx = tx
+		localCallbacks = &callbacks{}
+		ctx = contextWithCallbacks(contextWithOptions(ctx, opts), localCallbacks)
+	} else if err = opts.conflicts(optionsFromContext(ctx)); err != nil {
+		return newPropagationError(err, propagation)
 	}
-	if propagation == Savepoint {
+	var parentCallbacks *callbacks
+	if propagation == Savepoint || propagation == Nested {
+		if parentCallbacks = callbacksFromContext(ctx); parentCallbacks != nil {
+			// Callbacks registered in savepoint are discarded on savepoint rollback
+			ctx = contextWithCallbacks(ctx, &callbacks{})
+		}
 		savepoint = "sp" + strconv.FormatInt(time.Now().UnixNano(), 16) + strconv.FormatInt(rand.Int63(), 16)
 		_, err = tx.Exec("SAVEPOINT " + savepoint)
 		if err != nil {
+			if propagation == Nested {
+				return newPropagationError(err, propagation)
+			}
 			// Never return propagation error for Savepoint
 			return nil
 		}
@@ -93,9 +236,15 @@ func execute(ctx context.Context, propagation Propagation, execFunc ExecFunc) er
 	if savepoint != "" {
 		if err == nil {
 			tx.Exec("RELEASE SAVEPOINT " + savepoint)
+			if parentCallbacks != nil {
+				callbacksFromContext(ctx).release(parentCallbacks)
+			}
 		} else {
 			tx.Exec("ROLLBACK TO SAVEPOINT " + savepoint)
 		}
+		if propagation == Nested && err != nil {
+			return newPropagationError(err, propagation)
+		}
 		// Never return propagation error for Savepoint
 		return nil
 	}
@@ -3,7 +3,9 @@ package transactional_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aptogeo/pgrest/transactional"
 	"github.com/go-pg/pg/v10"
@@ -247,3 +249,317 @@ func TestTransactionalCurrentOKSavepointOK(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 2, count)
 }
+
+func TestTransactionalOptions(t *testing.T) {
+	db := initTests(t)
+	var err error
+	ctx := transactional.ContextWithDb(context.Background(), db)
+	err = transactional.ExecuteWithOptions(ctx, transactional.Options{Isolation: transactional.Serializable, ReadOnly: true, Deferrable: true}, func(ctx context.Context, tx *pg.Tx) error {
+		var isolation, readOnly, deferrable string
+		_, err := tx.QueryOneContext(ctx, pg.Scan(&isolation, &readOnly, &deferrable), "SELECT current_setting('transaction_isolation'), current_setting('transaction_read_only'), current_setting('transaction_deferrable')")
+		assert.Nil(t, err)
+		assert.Equal(t, "serializable", isolation)
+		assert.Equal(t, "on", readOnly)
+		assert.Equal(t, "on", deferrable)
+		_, err = tx.ModelContext(ctx, &Todo{Text: "ko"}).Insert()
+		return err
+	})
+	assert.NotNil(t, err)
+	count, err := db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	err = transactional.Execute(ctx, func(ctx context.Context, tx *pg.Tx) error {
+		return transactional.ExecuteWithOptions(ctx, transactional.Options{ReadOnly: true}, func(ctx context.Context, tx *pg.Tx) error {
+			return nil
+		})
+	})
+	assert.True(t, errors.Is(err, transactional.ErrConflictingOptions))
+
+	err = transactional.ExecuteWithOptions(ctx, transactional.Options{Isolation: transactional.RepeatableRead}, func(ctx context.Context, tx *pg.Tx) error {
+		return transactional.ExecuteWithOptions(ctx, transactional.Options{Isolation: transactional.Serializable}, func(ctx context.Context, tx *pg.Tx) error {
+			return nil
+		})
+	})
+	assert.True(t, errors.Is(err, transactional.ErrConflictingOptions))
+
+	err = transactional.ExecuteWithOptions(ctx, transactional.Options{Isolation: transactional.RepeatableRead, ReadOnly: true}, func(ctx context.Context, tx *pg.Tx) error {
+		return transactional.ExecuteWithOptions(ctx, transactional.Options{Propagation: transactional.Mandatory, Isolation: transactional.RepeatableRead}, func(ctx context.Context, tx *pg.Tx) error {
+			return nil
+		})
+	})
+	assert.Nil(t, err)
+}
+
+type pgError struct {
+	code string
+}
+
+func (e pgError) Field(field byte) string {
+	if field == 'C' {
+		return e.code
+	}
+	return ""
+}
+
+func (e pgError) IntegrityViolation() bool {
+	return false
+}
+
+func (e pgError) Error() string {
+	return "ERROR #" + e.code
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, transactional.IsRetryable(pgError{code: "40001"}))
+	assert.True(t, transactional.IsRetryable(fmt.Errorf("wrapped: %w", pgError{code: "40P01"})))
+	assert.False(t, transactional.IsRetryable(pgError{code: "23505"}))
+	assert.False(t, transactional.IsRetryable(errors.New("ko")))
+}
+
+func TestTransactionalRetry(t *testing.T) {
+	db := initTests(t)
+	var err error
+	var calls int
+	var attempts []int
+	ctx := transactional.ContextWithDb(context.Background(), db)
+	policy := &transactional.RetryPolicy{Attempts: 3, Backoff: time.Millisecond, OnRetry: func(attempt int, err error) {
+		attempts = append(attempts, attempt)
+	}}
+	err = transactional.ExecuteWithOptions(ctx, transactional.Options{Retry: policy}, func(ctx context.Context, tx *pg.Tx) error {
+		calls++
+		_, err := tx.ModelContext(ctx, &Todo{Text: "ok"}).Insert()
+		assert.Nil(t, err)
+		if calls < 3 {
+			return pgError{code: "40001"}
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 2}, attempts)
+	count, err := db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	calls = 0
+	attempts = nil
+	err = transactional.Execute(ctx, func(ctx context.Context, tx *pg.Tx) error {
+		// Nested transaction isn't retried
+		return transactional.ExecuteWithOptions(ctx, transactional.Options{Retry: policy}, func(ctx context.Context, tx *pg.Tx) error {
+			calls++
+			return pgError{code: "40P01"}
+		})
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Nil(t, attempts)
+
+	calls = 0
+	err = transactional.ExecuteWithOptions(ctx, transactional.Options{Retry: policy}, func(ctx context.Context, tx *pg.Tx) error {
+		calls++
+		return pgError{code: "40001"}
+	})
+	assert.True(t, transactional.IsRetryable(err))
+	assert.Equal(t, 3, calls)
+}
+
+type Audit struct {
+	ID   int
+	Text string
+}
+
+func TestTransactionalRequiresNew(t *testing.T) {
+	db := initTests(t)
+	var err error
+	// Table is shared by connections of new transactions
+	err = db.Model((*Audit)(nil)).CreateTable(&orm.CreateTableOptions{IfNotExists: true})
+	assert.Nil(t, err)
+	defer db.Model((*Audit)(nil)).DropTable(&orm.DropTableOptions{IfExists: true})
+	ctx := transactional.ContextWithDb(context.Background(), db)
+	err = transactional.Execute(ctx, func(ctx context.Context, tx *pg.Tx) error {
+		todo := &Todo{Text: "ko"}
+		_, err := tx.ModelContext(ctx, todo).Insert()
+		assert.Nil(t, err)
+		err = transactional.ExecuteWithPropagation(ctx, transactional.RequiresNew, func(ctx context.Context, newTx *pg.Tx) error {
+			assert.NotEqual(t, tx, newTx)
+			_, err := newTx.ModelContext(ctx, &Audit{Text: "ok"}).Insert()
+			return err
+		})
+		assert.Nil(t, err)
+		err = transactional.ExecuteWithPropagation(ctx, transactional.RequiresNew, func(ctx context.Context, newTx *pg.Tx) error {
+			_, err := newTx.ModelContext(ctx, &Audit{Text: "ko"}).Insert()
+			assert.Nil(t, err)
+			return errors.New("ko")
+		})
+		assert.NotNil(t, err)
+		return errors.New("ko")
+	})
+	assert.NotNil(t, err)
+	count, err := db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	count, err = db.Model(&Audit{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestTransactionalNotSupported(t *testing.T) {
+	db := initTests(t)
+	var err error
+	ctx := transactional.ContextWithDb(context.Background(), db)
+	err = transactional.Execute(ctx, func(ctx context.Context, tx *pg.Tx) error {
+		todo := &Todo{Text: "ok"}
+		_, err := tx.ModelContext(ctx, todo).Insert()
+		assert.Nil(t, err)
+		err = transactional.ExecuteWithPropagation(ctx, transactional.NotSupported, func(ctx context.Context, tx *pg.Tx) error {
+			assert.Nil(t, tx)
+			assert.Nil(t, transactional.TxFromContext(ctx))
+			assert.Equal(t, db, transactional.DbFromContext(ctx))
+			return errors.New("ko")
+		})
+		assert.NotNil(t, err)
+		return nil
+	})
+	assert.Nil(t, err)
+	count, err := db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestTransactionalNever(t *testing.T) {
+	db := initTests(t)
+	var err error
+	var calls int
+	ctx := transactional.ContextWithDb(context.Background(), db)
+	err = transactional.ExecuteWithPropagation(ctx, transactional.Never, func(ctx context.Context, tx *pg.Tx) error {
+		calls++
+		assert.Nil(t, tx)
+		_, err := transactional.DbFromContext(ctx).ModelContext(ctx, &Todo{Text: "ok"}).Insert()
+		return err
+	})
+	assert.Nil(t, err)
+	err = transactional.Execute(ctx, func(ctx context.Context, tx *pg.Tx) error {
+		return transactional.ExecuteWithPropagation(ctx, transactional.Never, func(ctx context.Context, tx *pg.Tx) error {
+			calls++
+			return nil
+		})
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+	count, err := db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestTransactionalNestedKO(t *testing.T) {
+	db := initTests(t)
+	var err error
+	ctx := transactional.ContextWithDb(context.Background(), db)
+	err = transactional.ExecuteWithPropagation(ctx, transactional.Nested, func(ctx context.Context, tx *pg.Tx) error {
+		todo := &Todo{Text: "ko"}
+		_, err := tx.ModelContext(ctx, todo).Insert()
+		assert.Nil(t, err)
+		return errors.New("ko")
+	})
+	assert.NotNil(t, err)
+	count, err := db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestTransactionalCurrentOKNestedKO(t *testing.T) {
+	db := initTests(t)
+	var err error
+	ctx := transactional.ContextWithDb(context.Background(), db)
+	err = transactional.ExecuteWithPropagation(ctx, transactional.Current, func(ctx context.Context, tx *pg.Tx) error {
+		todo := &Todo{Text: "ok"}
+		_, err := tx.ModelContext(ctx, todo).Insert()
+		assert.Nil(t, err)
+		err = transactional.ExecuteWithPropagation(ctx, transactional.Nested, func(ctx context.Context, tx *pg.Tx) error {
+			todo := &Todo{Text: "ko"}
+			_, err := tx.ModelContext(ctx, todo).Insert()
+			assert.Nil(t, err)
+			return errors.New("ko")
+		})
+		assert.NotNil(t, err)
+		// Error is handled, savepoint is rolled back
+		return nil
+	})
+	assert.Nil(t, err)
+	count, err := db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestTransactionalCurrentOKNestedOK(t *testing.T) {
+	db := initTests(t)
+	var err error
+	ctx := transactional.ContextWithDb(context.Background(), db)
+	err = transactional.ExecuteWithPropagation(ctx, transactional.Current, func(ctx context.Context, tx *pg.Tx) error {
+		todo := &Todo{Text: "ok"}
+		_, err := tx.ModelContext(ctx, todo).Insert()
+		assert.Nil(t, err)
+		return transactional.ExecuteWithPropagation(ctx, transactional.Nested, func(ctx context.Context, tx *pg.Tx) error {
+			todo := &Todo{Text: "ok"}
+			_, err := tx.ModelContext(ctx, todo).Insert()
+			return err
+		})
+	})
+	assert.Nil(t, err)
+	count, err := db.Model(&Todo{}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestTransactionalCallbacks(t *testing.T) {
+	db := initTests(t)
+	var err error
+	var events []string
+	ctx := transactional.ContextWithDb(context.Background(), db)
+	register := func(ctx context.Context, name string) {
+		transactional.AfterCommit(ctx, func() { events = append(events, name+" committed") })
+		transactional.AfterRollback(ctx, func() { events = append(events, name+" rolled back") })
+	}
+
+	err = transactional.Execute(ctx, func(ctx context.Context, tx *pg.Tx) error {
+		register(ctx, "current")
+		err := transactional.ExecuteWithPropagation(ctx, transactional.Nested, func(ctx context.Context, tx *pg.Tx) error {
+			register(ctx, "nested")
+			return nil
+		})
+		assert.Nil(t, err)
+		transactional.ExecuteWithPropagation(ctx, transactional.Savepoint, func(ctx context.Context, tx *pg.Tx) error {
+			register(ctx, "savepoint")
+			return errors.New("ko")
+		})
+		// Nothing runs before outermost transaction ends
+		assert.Nil(t, events)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"current committed", "nested committed"}, events)
+
+	events = nil
+	err = transactional.Execute(ctx, func(ctx context.Context, tx *pg.Tx) error {
+		register(ctx, "current")
+		return transactional.Execute(ctx, func(ctx context.Context, tx *pg.Tx) error {
+			register(ctx, "inner")
+			return errors.New("ko")
+		})
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"current rolled back", "inner rolled back"}, events)
+
+	events = nil
+	err = transactional.Execute(ctx, func(ctx context.Context, tx *pg.Tx) error {
+		register(ctx, "current")
+		return transactional.ExecuteWithPropagation(ctx, transactional.NotSupported, func(ctx context.Context, tx *pg.Tx) error {
+			// Without transaction, callback runs immediately
+			transactional.AfterCommit(ctx, func() { events = append(events, "immediate") })
+			return nil
+		})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"immediate", "current committed"}, events)
+}
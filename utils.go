@@ -3,6 +3,7 @@ package pgrest
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 
 	"github.com/go-pg/pg/v10/orm"
 	"github.com/go-pg/pg/v10/types"
@@ -64,74 +65,169 @@ func addQuerySorts(query *orm.Query, sorts []*Sort) *orm.Query {
 	q := query
 	if len(sorts) > 0 {
 		for _, sort := range sorts {
-			var orderExpr string
+			var direction string
 			if sort.Asc {
-				orderExpr = sort.Name + " ASC"
+				direction = " ASC"
 			} else {
-				orderExpr = sort.Name + " DESC"
+				direction = " DESC"
+			}
+			switch sort.Func {
+			case Similarity:
+				q = q.OrderExpr("? <-> ?"+direction, types.Ident(sort.Name), sort.Value)
+			case WordSimilarity:
+				q = q.OrderExpr("? <<-> ?"+direction, sort.Value, types.Ident(sort.Name))
+			case Distance:
+				q = q.OrderExpr("? <-> ?"+direction, types.Ident(sort.Name), sort.Value)
+			default:
+				q = q.Order(sort.Name + direction)
+			}
+		}
+	}
+	return q
+}
+
+// addQueryColumns adds fields, selects geometry field through geometry expression (ST_AsGeoJSON(?), ...)
+// and adds sort scores as virtual fields
+func addQueryColumns(query *orm.Query, table *orm.Table, fields []*Field, sorts []*Sort, geometryField string, geometryExpr string) *orm.Query {
+	if geometryExpr == "" {
+		geometryField = ""
+	}
+	hasScores := false
+	for _, sort := range sorts {
+		hasScores = hasScores || (sort.Func != "" && sort.Alias != "")
+	}
+	if geometryField == "" && !hasScores {
+		return addQueryFields(query, fields)
+	}
+	q := query
+	allColumns := len(fields) == 0
+	geometryAdded := false
+	addGeometry := func() {
+		if !geometryAdded {
+			q = q.ColumnExpr(geometryExpr+" AS ?", types.Ident(geometryField), types.Ident(geometryField))
+			geometryAdded = true
+		}
+	}
+	for _, field := range fields {
+		if field.Name == "*" {
+			allColumns = true
+		} else if f := findField(table, field.Name); f != nil && f.SQLName == geometryField {
+			addGeometry()
+		} else {
+			q = q.Column(field.Name)
+		}
+	}
+	if allColumns {
+		if geometryField == "" {
+			q = q.ColumnExpr("?TableColumns")
+		} else {
+			for _, f := range table.Fields {
+				if f.SQLName == geometryField {
+					addGeometry()
+				} else {
+					q = q.Column(f.SQLName)
+				}
 			}
-			q = q.Order(orderExpr)
+		}
+	}
+	for _, sort := range sorts {
+		if sort.Func == "" || sort.Alias == "" {
+			continue
+		}
+		switch sort.Func {
+		case Similarity:
+			q = q.ColumnExpr("similarity(?, ?) AS ?", types.Ident(sort.Name), sort.Value, types.Ident(sort.Alias))
+		case WordSimilarity:
+			q = q.ColumnExpr("word_similarity(?, ?) AS ?", sort.Value, types.Ident(sort.Name), types.Ident(sort.Alias))
+		case Distance:
+			q = q.ColumnExpr("? <-> ? AS ?", types.Ident(sort.Name), sort.Value, types.Ident(sort.Alias))
 		}
 	}
 	return q
 }
 
-func addQueryFilter(query *orm.Query, filter *Filter, parentGroupOp Op) *orm.Query {
+func addQueryFilter(query *orm.Query, filter *Filter, parentGroupOp Op) (*orm.Query, error) {
 	if filter == nil {
-		return query
+		return query, nil
 	}
 
 	if filter.Op == And || filter.Op == Or {
-		return addWhereGroup(query,
+		var err error
+		query = addWhereGroup(query,
 			func(query *orm.Query) (*orm.Query, error) {
 				q := query
 				for _, subfilter := range filter.Filters {
-					q = addQueryFilter(query, subfilter, filter.Op)
+					if q, err = addQueryFilter(query, subfilter, filter.Op); err != nil {
+						return nil, err
+					}
 				}
 				return q, nil
 			},
 			parentGroupOp)
+		return query, err
 	}
 
 	switch filter.Op {
 	case Eq:
-		return addWhere(query, "? = ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? = ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Neq:
-		return addWhere(query, "? != ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? != ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case In:
-		return addWhere(query, "? IN (?)", filter.Attr, types.In(filter.Value), parentGroupOp)
+		return addWhere(query, "? IN (?)", filter.Attr, types.In(filter.Value), parentGroupOp), nil
 	case Nin:
-		return addWhere(query, "? NOT IN (?)", filter.Attr, types.In(filter.Value), parentGroupOp)
+		return addWhere(query, "? NOT IN (?)", filter.Attr, types.In(filter.Value), parentGroupOp), nil
 	case Gt:
-		return addWhere(query, "? > ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? > ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Gte:
-		return addWhere(query, "? >= ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? >= ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Lt:
-		return addWhere(query, "? < ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? < ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Lte:
-		return addWhere(query, "? <= ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? <= ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Lk:
-		return addWhere(query, "? LIKE ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? LIKE ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Nlk:
-		return addWhere(query, "? NOT LIKE ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? NOT LIKE ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Ilk:
-		return addWhere(query, "? ILIKE ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? ILIKE ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Nilk:
-		return addWhere(query, "? NOT ILIKE ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? NOT ILIKE ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Sim:
-		return addWhere(query, "? SIMILAR TO ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? SIMILAR TO ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Nsim:
-		return addWhere(query, "? NOT SIMILAR TO ?", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "? NOT SIMILAR TO ?", filter.Attr, filter.Value, parentGroupOp), nil
 	case Ilkua:
-		return addWhere(query, "unaccent(?) ILIKE unaccent(?)", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "unaccent(?) ILIKE unaccent(?)", filter.Attr, filter.Value, parentGroupOp), nil
 	case Nilkua:
-		return addWhere(query, "unaccent(?) NOT ILIKE unaccent(?)", filter.Attr, filter.Value, parentGroupOp)
+		return addWhere(query, "unaccent(?) NOT ILIKE unaccent(?)", filter.Attr, filter.Value, parentGroupOp), nil
 	case Null:
-		return addWhere(query, "? IS NULL", filter.Attr, "", parentGroupOp)
+		return addWhere(query, "? IS NULL", filter.Attr, "", parentGroupOp), nil
 	case Nnull:
-		return addWhere(query, "? IS NOT NULL", filter.Attr, "", parentGroupOp)
+		return addWhere(query, "? IS NOT NULL", filter.Attr, "", parentGroupOp), nil
+	case Similar:
+		return addWhere(query, "? % ?", filter.Attr, filter.Value, parentGroupOp), nil
+	case Wsimilar:
+		return addWhere(query, "? %> ?", filter.Attr, filter.Value, parentGroupOp), nil
+	case Intersects:
+		return addWhereGeometry(query, "ST_Intersects(?, ?)", filter, parentGroupOp)
+	case Within:
+		return addWhereGeometry(query, "ST_Within(?, ?)", filter, parentGroupOp)
+	case Contains:
+		return addWhereGeometry(query, "ST_Contains(?, ?)", filter, parentGroupOp)
+	case Dwithin:
+		geometryDistance, err := ParseGeometryDistance(filter.Value)
+		if err != nil {
+			return nil, NewErrorParam("filter", err)
+		}
+		return addWhere(query, "ST_DWithin(?, ?, "+strconv.FormatFloat(geometryDistance.Distance, 'f', -1, 64)+")", filter.Attr, geometryDistance.Geometry, parentGroupOp), nil
+	case Bbox:
+		envelope, err := ParseEnvelope(filter.Value)
+		if err != nil {
+			return nil, NewErrorParam("filter", err)
+		}
+		return addWhere(query, "? && ?", filter.Attr, envelope, parentGroupOp), nil
 	default:
-		return query
+		return query, nil
 	}
 }
 
@@ -142,9 +238,52 @@ func addWhere(query *orm.Query, condition string, attribute string, value interf
 	return query.Where(condition, types.Ident(attribute), value)
 }
 
+func addWhereGeometry(query *orm.Query, condition string, filter *Filter, parentGroupOp Op) (*orm.Query, error) {
+	geometry, err := ParseGeometry(filter.Value)
+	if err != nil {
+		return nil, NewErrorParam("filter", err)
+	}
+	return addWhere(query, condition, filter.Attr, geometry, parentGroupOp), nil
+}
+
 func addWhereGroup(query *orm.Query, fnGroup func(query *orm.Query) (*orm.Query, error), parentGroupOp Op) *orm.Query {
 	if parentGroupOp == Or {
 		return query.WhereOrGroup(fnGroup)
 	}
 	return query.WhereGroup(fnGroup)
 }
+
+func usesPostgis(filter *Filter, sorts []*Sort) bool {
+	for _, sort := range sorts {
+		if sort.Func == Distance {
+			return true
+		}
+	}
+	return filterUsesOp(filter, Intersects, Within, Contains, Dwithin, Bbox)
+}
+
+func usesTrigram(filter *Filter, sorts []*Sort) bool {
+	for _, sort := range sorts {
+		if sort.Func == Similarity || sort.Func == WordSimilarity {
+			return true
+		}
+	}
+	return filterUsesOp(filter, Similar, Wsimilar)
+}
+
+func filterUsesOp(filter *Filter, ops ...Op) bool {
+	if filter == nil {
+		return false
+	}
+	for _, op := range ops {
+		if filter.Op == op {
+			return true
+		}
+	}
+	for _, subfilter := range filter.Filters {
+		if filterUsesOp(subfilter, ops...) {
+			return true
+		}
+	}
+	return false
+}
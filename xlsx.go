@@ -0,0 +1,412 @@
+package pgrest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+var xlsxRegexp = regexp.MustCompile("[+-/]vnd.openxmlformats-officedocument.spreadsheetml.sheet($|[+-;])")
+
+const xlsxNamespace = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+const xlsxRelNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+// xlsx cell styles defined in styles part
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDate
+)
+
+// xlsxEpoch is day 0 of spreadsheet date serial numbers
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// XLSXCodec structure, spreadsheet export with header row and typed cells, ParamsSheet adds
+// a second sheet listing query parameters
+type XLSXCodec struct {
+	ParamsSheet bool
+}
+
+// MediaTypes implements Codec
+func (XLSXCodec) MediaTypes() []string {
+	return []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}
+}
+
+// Encode implements Codec
+func (c XLSXCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.EncodeTo(&buf, restQuery, resource, entity); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeTo implements StreamEncoder, header row is built from selected fields
+func (c XLSXCodec) EncodeTo(writer io.Writer, restQuery *RestQuery, resource *Resource, entity interface{}) error {
+	if resource == nil {
+		return NewErrorBadRequest(fmt.Sprintf("resource '%v' not defined in engine configuration", restQuery.Resource))
+	}
+	if page, ok := entity.(*Page); ok {
+		entity = page.Slice
+	}
+	value := reflect.Indirect(reflect.ValueOf(entity))
+	if value.Kind() != reflect.Slice {
+		slice := reflect.MakeSlice(reflect.SliceOf(value.Type()), 0, 1)
+		value = reflect.Append(slice, value)
+	}
+	if value.Type().Elem() != resource.ResourceType() {
+		return NewErrorNotAcceptable(fmt.Sprintf("'%v' can't be encoded as XLSX", value.Type()))
+	}
+	sheets := []string{xlsxSheetName(resource.Name())}
+	if c.ParamsSheet {
+		sheets = append(sheets, "Query")
+	}
+	w := zip.NewWriter(writer)
+	if err := writeXLSXPackage(w, sheets); err != nil {
+		return err
+	}
+	sheet, err := newXLSXSheetWriter(w, 1)
+	if err != nil {
+		return err
+	}
+	fields := csvFields(orm.GetTable(resource.ResourceType()), restQuery.Fields)
+	cells := make([]*xlsxCell, len(fields))
+	for i, field := range fields {
+		cells[i] = xlsxStringCell(field.SQLName, xlsxStyleHeader)
+	}
+	sheet.row(cells)
+	for i := 0; i < value.Len(); i++ {
+		elem := value.Index(i)
+		for j, field := range fields {
+			cells[j] = xlsxValueCell(field.Value(elem))
+		}
+		sheet.row(cells)
+	}
+	if err := sheet.close(); err != nil {
+		return err
+	}
+	if c.ParamsSheet {
+		sheet, err := newXLSXSheetWriter(w, 2)
+		if err != nil {
+			return err
+		}
+		for _, param := range xlsxParams(restQuery) {
+			sheet.row([]*xlsxCell{xlsxStringCell(param[0], xlsxStyleHeader), xlsxStringCell(param[1], xlsxStyleDefault)})
+		}
+		if err := sheet.close(); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// Decode implements Codec
+func (XLSXCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	return ErrUnsupported
+}
+
+// xlsxParams gets names and values of query parameters used by export
+func xlsxParams(restQuery *RestQuery) [][2]string {
+	params := [][2]string{{"resource", restQuery.Resource}}
+	if restQuery.Key != "" {
+		params = append(params, [2]string{"key", restQuery.Key})
+	} else {
+		params = append(params, [2]string{"offset", strconv.Itoa(restQuery.Offset)}, [2]string{"limit", strconv.Itoa(restQuery.Limit)})
+	}
+	join := func(n int, str func(int) string) string {
+		strs := make([]string, n)
+		for i := range strs {
+			strs[i] = str(i)
+		}
+		return strings.Join(strs, ",")
+	}
+	if len(restQuery.Fields) > 0 {
+		params = append(params, [2]string{"fields", join(len(restQuery.Fields), func(i int) string { return restQuery.Fields[i].String() })})
+	}
+	if len(restQuery.Relations) > 0 {
+		params = append(params, [2]string{"relations", join(len(restQuery.Relations), func(i int) string { return restQuery.Relations[i].String() })})
+	}
+	if len(restQuery.Sorts) > 0 {
+		params = append(params, [2]string{"sorts", join(len(restQuery.Sorts), func(i int) string { return restQuery.Sorts[i].String() })})
+	}
+	if restQuery.Filter != nil && restQuery.Filter.String() != "" {
+		params = append(params, [2]string{"filter", restQuery.Filter.String()})
+	}
+	if restQuery.Crs != 0 {
+		params = append(params, [2]string{"crs", strconv.Itoa(restQuery.Crs)})
+	}
+	if restQuery.SearchPath != "" {
+		params = append(params, [2]string{"search_path", restQuery.SearchPath})
+	}
+	return params
+}
+
+// xlsxSheetName gets valid sheet name: at most 31 characters without []:*?/\
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune("[]:*?/\\", r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		return "Sheet1"
+	}
+	return name
+}
+
+// xlsxCell structure, sheet cell with inline string or value
+type xlsxCell struct {
+	XMLName xml.Name    `xml:"c"`
+	Ref     string      `xml:"r,attr"`
+	Style   int         `xml:"s,attr,omitempty"`
+	Type    string      `xml:"t,attr,omitempty"`
+	Value   string      `xml:"v,omitempty"`
+	Inline  *xlsxInline `xml:"is,omitempty"`
+}
+
+// xlsxInline structure, inline string of cell
+type xlsxInline struct {
+	Text xlsxText `xml:"t"`
+}
+
+// xlsxText structure, text preserving spaces
+type xlsxText struct {
+	Space string `xml:"xml:space,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// xlsxStringCell creates inline string cell
+func xlsxStringCell(str string, style int) *xlsxCell {
+	text := xlsxText{Value: str}
+	if strings.TrimSpace(str) != str {
+		text.Space = "preserve"
+	}
+	return &xlsxCell{Style: style, Type: "inlineStr", Inline: &xlsxInline{Text: text}}
+}
+
+// xlsxValueCell creates cell from field value: number, boolean, date or string, nil for NULL
+func xlsxValueCell(value reflect.Value) *xlsxCell {
+	value = reflect.Indirect(value)
+	if !value.IsValid() {
+		return nil
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return nil
+		}
+		// Dates are serial numbers of days in wall clock time
+		wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		days := float64(wall.Sub(xlsxEpoch)) / float64(24*time.Hour)
+		return &xlsxCell{Style: xlsxStyleDate, Value: strconv.FormatFloat(days, 'f', -1, 64)}
+	}
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			return &xlsxCell{Type: "b", Value: "1"}
+		}
+		return &xlsxCell{Type: "b", Value: "0"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &xlsxCell{Value: strconv.FormatInt(value.Int(), 10)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &xlsxCell{Value: strconv.FormatUint(value.Uint(), 10)}
+	case reflect.Float32, reflect.Float64:
+		if f := value.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return &xlsxCell{Value: strconv.FormatFloat(f, 'g', -1, 64)}
+		}
+	}
+	str := csvValue(value)
+	if str == "" {
+		return nil
+	}
+	return xlsxStringCell(str, xlsxStyleDefault)
+}
+
+// xlsxColumn gets column letters of zero based column index ('A', ..., 'Z', 'AA', ...)
+func xlsxColumn(i int) string {
+	column := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		column = string(rune('A'+(i-1)%26)) + column
+	}
+	return column
+}
+
+// xlsxSheetWriter structure, writes rows of worksheet part
+type xlsxSheetWriter struct {
+	writer  io.Writer
+	encoder *xml.Encoder
+	rows    int
+	err     error
+}
+
+// newXLSXSheetWriter creates writer of worksheet part with index
+func newXLSXSheetWriter(w *zip.Writer, index int) (*xlsxSheetWriter, error) {
+	writer, err := w.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", index))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(writer, xml.Header+`<worksheet xmlns="`+xlsxNamespace+`"><sheetData>`); err != nil {
+		return nil, err
+	}
+	return &xlsxSheetWriter{writer: writer, encoder: xml.NewEncoder(writer)}, nil
+}
+
+// row writes row of cells, nil cells are left empty
+func (s *xlsxSheetWriter) row(cells []*xlsxCell) {
+	if s.err != nil {
+		return
+	}
+	s.rows++
+	start := xml.StartElement{Name: xml.Name{Local: "row"}, Attr: []xml.Attr{{Name: xml.Name{Local: "r"}, Value: strconv.Itoa(s.rows)}}}
+	s.err = s.encoder.EncodeToken(start)
+	for i, cell := range cells {
+		if cell == nil || s.err != nil {
+			continue
+		}
+		cell.Ref = xlsxColumn(i) + strconv.Itoa(s.rows)
+		s.err = s.encoder.Encode(cell)
+	}
+	if s.err == nil {
+		s.err = s.encoder.EncodeToken(start.End())
+	}
+}
+
+// close ends worksheet part
+func (s *xlsxSheetWriter) close() error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.writer, "</sheetData></worksheet>")
+	return err
+}
+
+// xlsxRelationship structure, package relationship
+type xlsxRelationship struct {
+	ID     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+// xlsxRelationships structure, relationships part
+type xlsxRelationships struct {
+	XMLName       xml.Name           `xml:"http://schemas.openxmlformats.org/package/2006/relationships Relationships"`
+	Relationships []xlsxRelationship `xml:"Relationship"`
+}
+
+// xlsxContentTypes structure, content types part
+type xlsxContentTypes struct {
+	XMLName   xml.Name `xml:"http://schemas.openxmlformats.org/package/2006/content-types Types"`
+	Defaults  []xlsxContentTypeDefault
+	Overrides []xlsxContentTypeOverride
+}
+
+// xlsxContentTypeDefault structure, content type of extension
+type xlsxContentTypeDefault struct {
+	XMLName     xml.Name `xml:"Default"`
+	Extension   string   `xml:"Extension,attr"`
+	ContentType string   `xml:"ContentType,attr"`
+}
+
+// xlsxContentTypeOverride structure, content type of part
+type xlsxContentTypeOverride struct {
+	XMLName     xml.Name `xml:"Override"`
+	PartName    string   `xml:"PartName,attr"`
+	ContentType string   `xml:"ContentType,attr"`
+}
+
+// xlsxWorkbook structure, workbook part
+type xlsxWorkbook struct {
+	XMLName xml.Name    `xml:"workbook"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	XmlnsR  string      `xml:"xmlns:r,attr"`
+	Sheets  []xlsxSheet `xml:"sheets>sheet"`
+}
+
+// xlsxSheet structure, workbook sheet
+type xlsxSheet struct {
+	Name    string `xml:"name,attr"`
+	SheetID int    `xml:"sheetId,attr"`
+	RelID   string `xml:"r:id,attr"`
+}
+
+// xlsxStyles is styles part: default, bold header and date ('yyyy-mm-dd hh:mm:ss') cell formats
+const xlsxStyles = `<styleSheet xmlns="` + xlsxNamespace + `">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// writeXLSXPackage writes package parts other than worksheets
+func writeXLSXPackage(w *zip.Writer, sheets []string) error {
+	contentTypes := &xlsxContentTypes{
+		Defaults: []xlsxContentTypeDefault{
+			{Extension: "rels", ContentType: "application/vnd.openxmlformats-package.relationships+xml"},
+			{Extension: "xml", ContentType: "application/xml"},
+		},
+		Overrides: []xlsxContentTypeOverride{
+			{PartName: "/xl/workbook.xml", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"},
+			{PartName: "/xl/styles.xml", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"},
+		},
+	}
+	rels := &xlsxRelationships{Relationships: []xlsxRelationship{
+		{ID: "rId1", Type: xlsxRelNamespace + "/officeDocument", Target: "xl/workbook.xml"},
+	}}
+	workbook := &xlsxWorkbook{Xmlns: xlsxNamespace, XmlnsR: xlsxRelNamespace}
+	workbookRels := &xlsxRelationships{}
+	for i, name := range sheets {
+		id := fmt.Sprintf("rId%d", i+1)
+		target := fmt.Sprintf("worksheets/sheet%d.xml", i+1)
+		contentTypes.Overrides = append(contentTypes.Overrides, xlsxContentTypeOverride{PartName: "/xl/" + target, ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"})
+		workbook.Sheets = append(workbook.Sheets, xlsxSheet{Name: name, SheetID: i + 1, RelID: id})
+		workbookRels.Relationships = append(workbookRels.Relationships, xlsxRelationship{ID: id, Type: xlsxRelNamespace + "/worksheet", Target: target})
+	}
+	workbookRels.Relationships = append(workbookRels.Relationships, xlsxRelationship{ID: fmt.Sprintf("rId%d", len(sheets)+1), Type: xlsxRelNamespace + "/styles", Target: "styles.xml"})
+	parts := []struct {
+		name    string
+		content interface{}
+	}{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rels},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	}
+	for _, part := range parts {
+		writer, err := w.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(writer, xml.Header); err != nil {
+			return err
+		}
+		if err := xml.NewEncoder(writer).Encode(part.content); err != nil {
+			return err
+		}
+	}
+	writer, err := w.Create("xl/styles.xml")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(writer, xml.Header+xlsxStyles)
+	return err
+}
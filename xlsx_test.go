@@ -0,0 +1,86 @@
+package pgrest_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+type Loan struct {
+	ID       int
+	Borrower string
+	Amount   float64
+	Returned bool
+	LoanedAt time.Time
+	DueAt    *time.Time
+}
+
+func readXLSXPart(t *testing.T, data []byte, name string) string {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	for _, file := range reader.File {
+		if file.Name == name {
+			rc, err := file.Open()
+			assert.Nil(t, err)
+			defer rc.Close()
+			content, err := io.ReadAll(rc)
+			assert.Nil(t, err)
+			return string(content)
+		}
+	}
+	return ""
+}
+
+func TestXLSX(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	resource := pgrest.NewResource("Loan", (*Loan)(nil), pgrest.All)
+	config.AddResource(resource)
+	server := pgrest.NewServer(config)
+
+	var err error
+	var data []byte
+	var contentType string
+	var sheet string
+
+	loans := []Loan{
+		{ID: 1, Borrower: "Franz Kafka", Amount: 12.5, Returned: true, LoanedAt: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{ID: 2, Borrower: " R&D ", Amount: 3, LoanedAt: time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	page := &pgrest.Page{Slice: &loans, Offset: 0, Limit: 10, Count: 2}
+	restQuery := &pgrest.RestQuery{Action: pgrest.Get, Resource: "Loan", Accept: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Limit: 10}
+
+	data, contentType, err = server.Serialize(restQuery, page)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", contentType)
+	assert.Contains(t, readXLSXPart(t, data, "xl/workbook.xml"), `<sheet name="Loan" sheetId="1" r:id="rId1"></sheet>`)
+	assert.Equal(t, "", readXLSXPart(t, data, "xl/worksheets/sheet2.xml"))
+	assert.Contains(t, readXLSXPart(t, data, "[Content_Types].xml"), `PartName="/xl/worksheets/sheet1.xml"`)
+	sheet = readXLSXPart(t, data, "xl/worksheets/sheet1.xml")
+	assert.Contains(t, sheet, `<row r="1"><c r="A1" s="1" t="inlineStr"><is><t>id</t></is></c><c r="B1" s="1" t="inlineStr"><is><t>borrower</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="F1" s="1" t="inlineStr"><is><t>due_at</t></is></c></row>`)
+	assert.Contains(t, sheet, `<row r="2"><c r="A2"><v>1</v></c><c r="B2" t="inlineStr"><is><t>Franz Kafka</t></is></c><c r="C2"><v>12.5</v></c><c r="D2" t="b"><v>1</v></c><c r="E2" s="2"><v>43831.5</v></c></row>`)
+	assert.Contains(t, sheet, `<row r="3"><c r="A3"><v>2</v></c><c r="B3" t="inlineStr"><is><t xml:space="preserve"> R&amp;D </t></is></c><c r="C3"><v>3</v></c><c r="D3" t="b"><v>0</v></c><c r="E3" s="2"><v>61</v></c></row>`)
+	assert.True(t, bytes.HasSuffix([]byte(sheet), []byte("</sheetData></worksheet>")))
+
+	config.AddCodec(pgrest.XLSXCodec{ParamsSheet: true})
+	restQuery.Fields = []*pgrest.Field{{Name: "borrower"}, {Name: "Amount"}}
+	restQuery.Sorts = []*pgrest.Sort{{Name: "amount", Asc: false}}
+	data, _, err = server.Serialize(restQuery, &loans[0])
+	assert.Nil(t, err)
+	assert.Contains(t, readXLSXPart(t, data, "xl/workbook.xml"), `<sheet name="Query" sheetId="2" r:id="rId2"></sheet>`)
+	sheet = readXLSXPart(t, data, "xl/worksheets/sheet1.xml")
+	assert.Contains(t, sheet, `<sheetData><row r="1"><c r="A1" s="1" t="inlineStr"><is><t>borrower</t></is></c><c r="B1" s="1" t="inlineStr"><is><t>amount</t></is></c></row><row r="2"><c r="A2" t="inlineStr"><is><t>Franz Kafka</t></is></c><c r="B2"><v>12.5</v></c></row></sheetData>`)
+	sheet = readXLSXPart(t, data, "xl/worksheets/sheet2.xml")
+	assert.Contains(t, sheet, `<c r="A1" s="1" t="inlineStr"><is><t>resource</t></is></c><c r="B1" t="inlineStr"><is><t>Loan</t></is></c>`)
+	assert.Contains(t, sheet, `<t>fields</t></is></c><c r="B4" t="inlineStr"><is><t>borrower,Amount</t></is></c>`)
+	assert.Contains(t, sheet, `<t>sorts</t></is></c><c r="B5" t="inlineStr"><is><t>desc(amount)</t></is></c>`)
+
+	_, _, err = server.Serialize(restQuery, &pgrest.Page{Slice: &[]Author{}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 406, err.(*pgrest.Error).StatusCode())
+}
@@ -0,0 +1,348 @@
+package pgrest
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XMLCodec structure, XML codec using json tags as element names, page is root element
+// with offset, limit and count attributes and []byte is base64
+type XMLCodec struct{}
+
+// MediaTypes implements Codec
+func (XMLCodec) MediaTypes() []string {
+	return []string{"application/xml; charset=utf-8", "text/xml"}
+}
+
+// Encode implements Codec
+func (XMLCodec) Encode(restQuery *RestQuery, resource *Resource, entity interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	w := newXMLWriter(&buf)
+	if page, ok := entity.(*Page); ok {
+		w.start("page", "offset", strconv.Itoa(page.Offset), "limit", strconv.Itoa(page.Limit), "count", strconv.Itoa(page.Count))
+		slice := reflect.Indirect(reflect.ValueOf(page.Slice))
+		if slice.Kind() == reflect.Slice {
+			name := xmlItemName(slice.Type().Elem(), resource)
+			for i := 0; i < slice.Len(); i++ {
+				writeXMLValue(w, name, slice.Index(i))
+			}
+		}
+		w.end("page")
+	} else {
+		value := reflect.ValueOf(entity)
+		writeXMLValue(w, xmlItemName(value.Type(), resource), value)
+	}
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements Codec, root element children are decoded into entity (or into slice items)
+func (XMLCodec) Decode(restQuery *RestQuery, resource *Resource, content []byte, entity interface{}) error {
+	root, err := parseXMLNode(content)
+	if err == nil {
+		err = decodeXMLValue(root, reflect.ValueOf(entity).Elem())
+	}
+	if err != nil {
+		return &Error{Message: "invalid XML content", Code: 400, Cause: err}
+	}
+	return nil
+}
+
+// xmlItemName gets element name of entity type: resource name or type name
+func xmlItemName(typ reflect.Type, resource *Resource) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if resource != nil && typ == resource.ResourceType() {
+		return resource.Name()
+	}
+	if typ.Name() != "" {
+		return typ.Name()
+	}
+	return "item"
+}
+
+// structFieldName gets name of struct field from json tag or go name and omitempty option, empty if field is ignored
+func structFieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" && !field.Anonymous {
+		return "", false
+	}
+	tags := strings.Split(field.Tag.Get("json"), ",")
+	if tags[0] == "-" {
+		return "", false
+	}
+	omitEmpty := false
+	for _, tag := range tags[1:] {
+		omitEmpty = omitEmpty || tag == "omitempty"
+	}
+	if tags[0] != "" {
+		return tags[0], omitEmpty
+	}
+	return field.Name, omitEmpty
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// writeXMLValue writes value as element with attributes, nil values are omitted
+func writeXMLValue(w *xmlWriter, name string, value reflect.Value, attrs ...string) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Type() == timeType {
+		w.text(name, value.Interface().(time.Time).Format(time.RFC3339Nano), attrs...)
+		return
+	}
+	if value.Type().Implements(textMarshalerType) {
+		text, err := value.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+		w.text(name, string(text), attrs...)
+		return
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		w.start(name, attrs...)
+		writeXMLFields(w, value)
+		w.end(name)
+	case reflect.Slice, reflect.Array:
+		if value.Type() == reflect.TypeOf(json.RawMessage{}) {
+			w.text(name, string(value.Bytes()), attrs...)
+		} else if value.Type().Elem().Kind() == reflect.Uint8 && value.Kind() == reflect.Slice {
+			if value.IsNil() {
+				return
+			}
+			w.text(name, base64.StdEncoding.EncodeToString(value.Bytes()), attrs...)
+		} else {
+			if value.Kind() == reflect.Slice && value.IsNil() {
+				return
+			}
+			w.start(name, attrs...)
+			itemName := xmlItemName(value.Type().Elem(), nil)
+			for i := 0; i < value.Len(); i++ {
+				writeXMLValue(w, itemName, value.Index(i))
+			}
+			w.end(name)
+		}
+	case reflect.Map:
+		if value.IsNil() {
+			return
+		}
+		// Keys aren't valid element names in general, entries are elements with key attribute
+		w.start(name, attrs...)
+		keys := value.MapKeys()
+		strs := make([]string, len(keys))
+		for i, key := range keys {
+			strs[i] = fmt.Sprint(key.Interface())
+		}
+		m := make(map[string]interface{}, len(keys))
+		for i, key := range keys {
+			m[strs[i]] = value.MapIndex(key).Interface()
+		}
+		for _, k := range sortedKeys(m) {
+			writeXMLValue(w, "entry", reflect.ValueOf(m[k]), "key", k)
+		}
+		w.end(name)
+	case reflect.Float32, reflect.Float64:
+		w.text(name, strconv.FormatFloat(value.Float(), 'f', -1, 64), attrs...)
+	default:
+		w.text(name, fmt.Sprint(value.Interface()), attrs...)
+	}
+}
+
+// writeXMLFields writes struct fields as elements, embedded struct fields are inlined
+func writeXMLFields(w *xmlWriter, value reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Anonymous && field.Tag.Get("json") == "" && reflect.Indirect(value.Field(i)).Kind() == reflect.Struct {
+			writeXMLFields(w, reflect.Indirect(value.Field(i)))
+			continue
+		}
+		name, omitEmpty := structFieldName(field)
+		if name == "" || (omitEmpty && value.Field(i).IsZero()) {
+			continue
+		}
+		writeXMLValue(w, name, value.Field(i))
+	}
+}
+
+// xmlNode structure, parsed XML element
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*xmlNode
+}
+
+// parseXMLNode parses root element
+func parseXMLNode(content []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if root != nil && len(stack) == 0 {
+				return root, nil
+			}
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: make(map[string]string, len(t.Attr))}
+			for _, attr := range t.Attr {
+				node.attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+}
+
+// decodeXMLValue decodes element into value
+func decodeXMLValue(node *xmlNode, value reflect.Value) error {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return decodeXMLValue(node, value.Elem())
+	}
+	text := strings.TrimSpace(node.text)
+	if value.Type() == timeType {
+		t, err := coerceTime(text)
+		if err != nil {
+			return err
+		}
+		value.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		for _, child := range node.children {
+			field := findStructField(value, child.name)
+			if !field.IsValid() {
+				continue
+			}
+			if err := decodeXMLValue(child, field); err != nil {
+				return fmt.Errorf("invalid value for element '%v' (%v)", child.name, err)
+			}
+		}
+	case reflect.Slice:
+		if value.Type() == reflect.TypeOf(json.RawMessage{}) {
+			value.SetBytes([]byte(text))
+		} else if value.Type().Elem().Kind() == reflect.Uint8 {
+			data, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				return err
+			}
+			value.SetBytes(data)
+		} else {
+			slice := reflect.MakeSlice(value.Type(), len(node.children), len(node.children))
+			for i, child := range node.children {
+				if err := decodeXMLValue(child, slice.Index(i)); err != nil {
+					return err
+				}
+			}
+			value.Set(slice)
+		}
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map type '%v'", value.Type())
+		}
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+		for _, child := range node.children {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			if err := decodeXMLValue(child, elem); err != nil {
+				return err
+			}
+			key, ok := child.attrs["key"]
+			if !ok {
+				key = child.name
+			}
+			value.SetMapIndex(reflect.ValueOf(key).Convert(value.Type().Key()), elem)
+		}
+	case reflect.Interface:
+		value.Set(reflect.ValueOf(text))
+	case reflect.String:
+		value.SetString(node.text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type '%v'", value.Type())
+	}
+	return nil
+}
+
+// findStructField finds struct field by json name, then by case insensitive go name
+func findStructField(value reflect.Value, name string) reflect.Value {
+	var found reflect.Value
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Anonymous && field.Tag.Get("json") == "" && field.Type.Kind() == reflect.Struct {
+			if f := findStructField(value.Field(i), name); f.IsValid() {
+				return f
+			}
+			continue
+		}
+		fieldName, _ := structFieldName(field)
+		if fieldName == name {
+			return value.Field(i)
+		}
+		if fieldName != "" && !found.IsValid() && strings.EqualFold(field.Name, name) {
+			found = value.Field(i)
+		}
+	}
+	return found
+}
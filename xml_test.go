@@ -0,0 +1,56 @@
+package pgrest_test
+
+import (
+	"testing"
+
+	"github.com/aptogeo/pgrest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXML(t *testing.T) {
+	config := pgrest.NewConfig("/rest/", nil)
+	resource := pgrest.NewResource("Author", (*Author)(nil), pgrest.All)
+	config.AddResource(resource)
+	server := pgrest.NewServer(config)
+
+	var err error
+	var data []byte
+	var contentType string
+
+	authors := []Author{
+		{ID: 1, Firstname: "Antoine", Lastname: "de Saint Exupéry", Picture: []byte{187, 163, 35, 30}, Books: []*Book{{ID: 1, Title: "Vol de nuit", AuthorID: 1}}},
+		{ID: 2, Firstname: "Franz", Lastname: "Kafka & co"},
+	}
+	data, contentType, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Author", Accept: "application/xml"}, &pgrest.Page{Slice: &authors, Offset: 0, Limit: 10, Count: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, "application/xml; charset=utf-8", contentType)
+	assert.Contains(t, string(data), `<page offset="0" limit="10" count="2"><Author><ID>1</ID><Firstname>Antoine</Firstname><Lastname>de Saint Exupéry</Lastname><Picture>u6MjHg==</Picture><Books><Book><ID>1</ID><Title>Vol de nuit</Title><NbPages>0</NbPages><AuthorID>1</AuthorID></Book></Books><TransientField></TransientField><Score>0</Score></Author>`)
+	assert.Contains(t, string(data), `<Lastname>Kafka &amp; co</Lastname>`)
+
+	data, _, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Author", Accept: "text/xml"}, &authors[0])
+	assert.Nil(t, err)
+	resAuthor := &Author{}
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "application/xml", Content: data}, resource, resAuthor)
+	assert.Nil(t, err)
+	assert.Equal(t, authors[0], *resAuthor)
+
+	resAuthor = &Author{}
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "application/xml", Content: []byte("<Author><firstname>Franz</firstname><id>abc</id></Author>")}, resource, resAuthor)
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+	assert.Equal(t, "Franz", resAuthor.Firstname)
+
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "application/xml", Content: []byte("<Author><firstname>")}, resource, resAuthor)
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.(*pgrest.Error).StatusCode())
+
+	// Map keys aren't element names
+	cluster := pgrest.ClusterItem{Geometry: "POINT(2.3 48.86)", Count: 2, Aggregates: map[string]interface{}{"sum(nb_pages)": 730}}
+	data, _, err = server.Serialize(&pgrest.RestQuery{Action: pgrest.Get, Resource: "Author", Accept: "application/xml"}, &cluster)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `<ClusterItem><geometry>POINT(2.3 48.86)</geometry><count>2</count><aggregates><entry key="sum(nb_pages)">730</entry></aggregates></ClusterItem>`)
+	resCluster := &pgrest.ClusterItem{}
+	err = server.Deserialize(&pgrest.RestQuery{Action: pgrest.Post, Resource: "Author", ContentType: "application/xml", Content: data}, resource, resCluster)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"sum(nb_pages)": "730"}, resCluster.Aggregates)
+}